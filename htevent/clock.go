@@ -0,0 +1,106 @@
+package htevent
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the time used by the operators, see SetClock.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f after d, f must not be blocked by the caller.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending call of Clock.AfterFunc.
+type Timer interface {
+	// Stop prevents the call, it returns false if it was already called or stopped.
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+var defaultClock Clock = realClock{}
+
+// ManualClock is a Clock moved by Advance, to test the operators deterministically.
+// The timers are called by Advance, in the goroutine calling it.
+type ManualClock struct {
+	now    time.Time
+	timers []*manualTimer
+	mu     sync.Mutex
+}
+
+type manualTimer struct {
+	at    time.Time
+	f     func()
+	clock *ManualClock
+}
+
+// NewManualClock creates a clock at start.
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{at: c.now.Add(d), f: f, clock: c}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock by d and calls the timers due, in time order.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].at.Before(c.timers[j].at)
+		})
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		if t.at.After(c.now) {
+			c.now = t.at
+		}
+		c.mu.Unlock()
+
+		// timers added by f are due in this Advance too
+		t.f()
+	}
+}
+
+func (t *manualTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, o := range c.timers {
+		if o == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
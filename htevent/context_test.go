@@ -0,0 +1,89 @@
+package htevent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+// the listeners taking a context get the one of HandlerContext.
+func TestHandlerContextArgument(t *testing.T) {
+	d := NewHTDispatcher()
+	got := make(chan interface{}, 1)
+	d.On("job", func(ctx context.Context, i int) { got <- ctx.Value(ctxKey{}) })
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "v")
+	if err := d.HandlerContext(ctx, "job", 1); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-got; v != "v" {
+		t.Fatalf("got %v, want v", v)
+	}
+}
+
+// the dispatch stops waiting at the deadline and reports the listeners still running.
+func TestHandlerContextDeadline(t *testing.T) {
+	d := NewHTDispatcher()
+	release := make(chan struct{})
+	defer close(release)
+	d.On("job", func() {})
+	d.On("job", func() { <-release })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := d.HandlerContext(ctx, "job")
+	if time.Since(start) > time.Second {
+		t.Fatal("HandlerContext waited for the slow listener")
+	}
+	var errs ListenerErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Index != 1 {
+		t.Fatalf("got %v, want listener[1] only", err)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
+
+// a cancelled context calls no listener.
+func TestHandlerContextCancelled(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+	var called bool
+	d.On("job", func() { called = true })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.HandlerContext(ctx, "job"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if called {
+		t.Fatal("a listener was called with a cancelled context")
+	}
+}
+
+// WithTimeout fails the slow listener alone and cancels its context.
+func TestListenerTimeout(t *testing.T) {
+	d := NewHTDispatcher()
+	cancelled := make(chan struct{})
+	d.On("job", func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	}, WithTimeout(10*time.Millisecond))
+	d.On("job", func() {})
+
+	err := d.Handler("job")
+	var errs ListenerErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Index != 0 ||
+		!errors.Is(errs[0], context.DeadlineExceeded) {
+		t.Fatalf("got %v, want listener[0] timed out", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the listener context wasn't cancelled")
+	}
+}
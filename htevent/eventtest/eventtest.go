@@ -0,0 +1,234 @@
+// Package eventtest helps to test the code emitting htevent events: a dispatcher
+// recording every dispatch, assertions on the recorded events and a deterministic mode.
+package eventtest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
+)
+
+// T is the part of testing.TB used by the assertions.
+type T interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Call is a recorded dispatch.
+type Call struct {
+	Name    string
+	Args    []interface{}
+	Err     error // returned by the dispatch, nil until it returns
+	Time    time.Time
+	Request bool // made by Request, see htevent.IsRequest
+}
+
+// Recorder is a dispatcher recording every dispatch: Handler, HandlerContext,
+// EmitSticky, Request and the Emit of typed topics.
+type Recorder struct {
+	htevent.HTDispatcher
+
+	calls   []*Call
+	changed chan struct{} // closed and replaced on every record
+	mu      sync.Mutex
+
+	deterministic bool
+	clock         *htevent.ManualClock
+}
+
+// NewDispatcher creates a new recording dispatcher.
+func NewDispatcher() *Recorder {
+	return Record(htevent.NewHTDispatcher())
+}
+
+// Record records the dispatches of d from now on.
+func Record(d htevent.HTDispatcher) *Recorder {
+	r := &Recorder{
+		HTDispatcher: d,
+		changed:      make(chan struct{}),
+	}
+	d.Use(r.middleware)
+	return r
+}
+
+// record the dispatch before calling next, so the events emitted by the listeners
+// come after it, then set its error.
+func (r *Recorder) middleware(next htevent.HandlerFunc) htevent.HandlerFunc {
+	return func(ctx context.Context, name string, args ...interface{}) error {
+		c := &Call{
+			Name:    name,
+			Args:    append([]interface{}(nil), args...),
+			Time:    time.Now(),
+			Request: htevent.IsRequest(ctx),
+		}
+		r.mu.Lock()
+		r.calls = append(r.calls, c)
+		close(r.changed)
+		r.changed = make(chan struct{})
+		r.mu.Unlock()
+
+		err := next(ctx, name, args...)
+
+		r.mu.Lock()
+		c.Err = err
+		r.mu.Unlock()
+		return err
+	}
+}
+
+// Calls returns the recorded dispatches in order.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	calls := make([]Call, 0, len(r.calls))
+	for _, c := range r.calls {
+		calls = append(calls, *c)
+	}
+	return calls
+}
+
+// CallsOf returns the recorded dispatches of the event name.
+func (r *Recorder) CallsOf(name string) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var calls []Call
+	for _, c := range r.calls {
+		if c.Name == name {
+			calls = append(calls, *c)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded dispatches.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+// WaitFor waits until the event name is dispatched, and returns its first dispatch.
+// A dispatch recorded before the call counts. The dispatch may still be running,
+// its Err is set when it returns.
+func (r *Recorder) WaitFor(name string, timeout time.Duration) (Call, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		r.mu.Lock()
+		for _, c := range r.calls {
+			if c.Name == name {
+				r.mu.Unlock()
+				return *c, nil
+			}
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return Call{}, fmt.Errorf("%s was not emitted within %s", name, timeout)
+		}
+	}
+}
+
+// AssertEmitted checks that the event name was dispatched, with args if any are given.
+func (r *Recorder) AssertEmitted(t T, name string, args ...interface{}) bool {
+	t.Helper()
+	calls := r.CallsOf(name)
+	if len(calls) == 0 {
+		t.Errorf("%s was not emitted", name)
+		return false
+	}
+	if len(args) == 0 {
+		return true
+	}
+	for _, c := range calls {
+		if reflect.DeepEqual(c.Args, args) {
+			return true
+		}
+	}
+	got := make([][]interface{}, 0, len(calls))
+	for _, c := range calls {
+		got = append(got, c.Args)
+	}
+	t.Errorf("%s was not emitted with %v, but with %v", name, args, got)
+	return false
+}
+
+// AssertNotEmitted checks that the event name wasn't dispatched.
+func (r *Recorder) AssertNotEmitted(t T, name string) bool {
+	t.Helper()
+	if calls := r.CallsOf(name); len(calls) > 0 {
+		t.Errorf("%s was emitted %d times", name, len(calls))
+		return false
+	}
+	return true
+}
+
+// AssertEmittedTimes checks that the event name was dispatched n times.
+func (r *Recorder) AssertEmittedTimes(t T, name string, n int) bool {
+	t.Helper()
+	if calls := r.CallsOf(name); len(calls) != n {
+		t.Errorf("%s was emitted %d times, expected %d", name, len(calls), n)
+		return false
+	}
+	return true
+}
+
+// Deterministic calls the listeners in the dispatching goroutine, in priority and
+// registration order, whatever mode the code under test sets. The operators
+// (Debounce, Throttle, Coalesce) use the returned clock, moved by Advance.
+func (r *Recorder) Deterministic(start time.Time) *htevent.ManualClock {
+	r.mu.Lock()
+	r.deterministic = true
+	r.clock = htevent.NewManualClock(start)
+	clock := r.clock
+	r.mu.Unlock()
+
+	r.HTDispatcher.SetMode(htevent.ModeSync)
+	r.HTDispatcher.SetClock(clock)
+	return clock
+}
+
+// Unwrap returns the recorded dispatcher.
+func (r *Recorder) Unwrap() htevent.HTDispatcher {
+	return r.HTDispatcher
+}
+
+// SetMode is ignored in the deterministic mode.
+func (r *Recorder) SetMode(mode htevent.DispatchMode) error {
+	if r.isDeterministic() {
+		return nil
+	}
+	return r.HTDispatcher.SetMode(mode)
+}
+
+// SetEventMode is ignored in the deterministic mode.
+func (r *Recorder) SetEventMode(name string, mode htevent.DispatchMode) error {
+	if r.isDeterministic() {
+		return nil
+	}
+	return r.HTDispatcher.SetEventMode(name, mode)
+}
+
+// SetClock is ignored in the deterministic mode.
+func (r *Recorder) SetClock(c htevent.Clock) error {
+	if r.isDeterministic() {
+		return nil
+	}
+	return r.HTDispatcher.SetClock(c)
+}
+
+func (r *Recorder) isDeterministic() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.deterministic
+}
+
+var _ htevent.HTDispatcher = (*Recorder)(nil)
@@ -0,0 +1,149 @@
+package eventtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
+)
+
+// fakeT collects the assertion failures.
+type fakeT struct {
+	errs []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errs = append(f.errs, fmt.Sprintf(format, args...))
+}
+
+func callNames(calls []Call) []string {
+	names := make([]string, 0, len(calls))
+	for _, c := range calls {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// an event emitted by a listener is recorded after the one it handles,
+// whose error is set when it returns.
+func TestRecordNestedOrder(t *testing.T) {
+	d := NewDispatcher()
+	d.Deterministic(time.Unix(0, 0))
+	failed := errors.New("failed")
+	d.On("order.created", func(id int) error {
+		d.Handler("order.validated", id)
+		return failed
+	})
+	d.On("order.validated", func(id int) {
+		d.Handler("mail.sent", id)
+	})
+	d.On("mail.sent", func(id int) {})
+
+	d.Handler("order.created", 1)
+	calls := d.Calls()
+	if got := fmt.Sprint(callNames(calls)); got != "[order.created order.validated mail.sent]" {
+		t.Fatalf("got %s", got)
+	}
+	if !errors.Is(calls[0].Err, failed) || calls[1].Err != nil {
+		t.Fatalf("errors %v %v", calls[0].Err, calls[1].Err)
+	}
+}
+
+func TestAssertions(t *testing.T) {
+	d := NewDispatcher()
+	d.On("a", func(i int) {})
+	d.Handler("a", 1)
+	d.Handler("a", 2)
+
+	d.AssertEmitted(t, "a")
+	d.AssertEmitted(t, "a", 2)
+	d.AssertEmittedTimes(t, "a", 2)
+	d.AssertNotEmitted(t, "b")
+
+	ft := &fakeT{}
+	d.AssertEmitted(ft, "a", 3)
+	d.AssertEmitted(ft, "b")
+	d.AssertNotEmitted(ft, "a")
+	d.AssertEmittedTimes(ft, "a", 1)
+	if len(ft.errs) != 4 || !strings.Contains(ft.errs[0], "not emitted with [3]") {
+		t.Fatalf("got %q", ft.errs)
+	}
+
+	d.Reset()
+	d.AssertNotEmitted(t, "a")
+}
+
+// typed topics and sticky events are recorded too.
+func TestRecordTypedAndSticky(t *testing.T) {
+	d := NewDispatcher()
+	topic, err := htevent.NewTopic[string](d, "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic.Emit("x")
+	d.EmitSticky("ready", true)
+	d.AssertEmitted(t, "s", "x")
+	d.AssertEmitted(t, "ready", true)
+}
+
+func TestWaitFor(t *testing.T) {
+	d := NewDispatcher()
+	d.On("done", func() {})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		d.Handler("done")
+	}()
+	if _, err := d.WaitFor("done", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.WaitFor("never", 10*time.Millisecond); err == nil {
+		t.Fatal("waited for an event never emitted")
+	}
+}
+
+// the deterministic mode ignores the modes set by the code under test
+// and moves the operators with its clock.
+func TestDeterministic(t *testing.T) {
+	d := NewDispatcher()
+	clock := d.Deterministic(time.Unix(0, 0))
+	d.SetMode(htevent.ModeAsync)
+	var got []int
+	d.On("a", func(i int) { got = append(got, i) })
+	d.SetEventMode("a", htevent.ModeAsync)
+	d.Handler("a", 1)
+	d.Handler("a", 2)
+	if fmt.Sprint(got) != "[1 2]" {
+		t.Fatalf("got %v", got)
+	}
+
+	d.SetClock(htevent.NewManualClock(time.Unix(100, 0)))
+	d.Debounce("a", time.Second)
+	d.Handler("a", 3)
+	clock.Advance(time.Second)
+	if fmt.Sprint(got) != "[1 2 3]" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+// requests are recorded and marked.
+func TestRecordRequest(t *testing.T) {
+	d := NewDispatcher()
+	d.On("user.get", func(id int) string { return "bob" })
+	d.On("user.seen", func(id int) {})
+
+	if _, err := d.Request(context.Background(), "user.get", 1); err != nil {
+		t.Fatal(err)
+	}
+	d.Handler("user.seen", 1)
+
+	calls := d.Calls()
+	if len(calls) != 2 || calls[0].Name != "user.get" || !calls[0].Request || calls[1].Request {
+		t.Fatalf("got %+v", calls)
+	}
+}
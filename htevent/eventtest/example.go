@@ -0,0 +1,38 @@
+package eventtest
+
+import (
+	"fmt"
+	"time"
+)
+
+// printT prints the failed assertions, a *testing.T in real tests.
+type printT struct{}
+
+func (printT) Helper() {}
+
+func (printT) Errorf(format string, args ...interface{}) {
+	fmt.Printf(format+"\n", args...)
+}
+
+func Eventtest_test() {
+	d := NewDispatcher()
+	clock := d.Deterministic(time.Now())
+
+	d.On("msg0", func(i int) {
+		fmt.Printf("msg0 dispatch ok : %d\n", i)
+	})
+	d.Debounce("msg0", time.Second)
+
+	d.Handler("msg0", 0)
+	d.Handler("msg0", 1)
+	clock.Advance(time.Second) // msg0 dispatch ok : 1
+
+	d.AssertEmitted(printT{}, "msg0", 0)
+	d.AssertEmittedTimes(printT{}, "msg0", 2)
+	d.AssertNotEmitted(printT{}, "msg1")
+
+	go d.Handler("msg1", "str")
+	if _, err := d.WaitFor("msg1", time.Second); err != nil {
+		fmt.Println(err)
+	}
+}
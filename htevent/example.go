@@ -1,7 +1,11 @@
 package htevent
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 func HTEvent_test() {
@@ -20,5 +24,69 @@ func HTEvent_test() {
 	dispatcher.Handler("msg1", "str")
 	err = dispatcher.Handler("msg1", 0) // error
 	fmt.Println(err)
+
+	// typed topic, listeners with a wrong signature fail to compile
+	topic, _ := NewTopic[int](dispatcher, "msg0")
+	topic.On(func(i int) {
+		fmt.Printf("typed msg0 dispatch ok : %d\n", i)
+	})
+	topic.Emit(1)
+
+	// listener errors and panics are returned by Handler
+	dispatcher.On("msg3", func(i int) error {
+		return fmt.Errorf("bad msg3 %d", i)
+	})
+	err = dispatcher.Handler("msg3", 0) // error
+	fmt.Println(err)
+
+	// anonymous listeners are removed through their subscription
+	sub, _ := dispatcher.On("msg1", func(s string) {
+		fmt.Printf("msg1 subscription : %s\n", s)
+	})
+	dispatcher.Once("msg1", func(s string) {
+		fmt.Printf("msg1 once : %s\n", s)
+	})
+	dispatcher.Handler("msg1", "str")
+	sub.Unsubscribe()
+	dispatcher.Handler("msg1", "str")
+
+	// late listeners get the sticky value
+	dispatcher.EmitSticky("ready", "msg")
+	dispatcher.On("ready", func(s string) {
+		fmt.Printf("ready : %s\n", s)
+	})
 }
 
+
+func HTJournal_test() {
+	dir, err := os.MkdirTemp("", "htevent_journal")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	journal, err := OpenJournal(filepath.Join(dir, "events"), JournalJSON)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer journal.Close()
+	journal.SetArgTypes("msg0", 0)
+
+	dispatcher := NewHTDispatcher()
+	dispatcher.Use(journal.Middleware)
+	dispatcher.On("msg0", func(i int) {
+		fmt.Printf("msg0 dispatch ok : %d\n", i)
+	})
+	dispatcher.Handler("msg0", 1)
+
+	// rebuild the state after a restart
+	journal.Replay(time.Now().Add(-time.Hour), dispatcher.HandlerContext)
+
+	// a late consumer catches up on the events it missed
+	journal.Consume("audit", func(ctx context.Context, name string, args ...interface{}) error {
+		fmt.Println("audit", name, args)
+		return nil
+	})
+}
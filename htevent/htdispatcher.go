@@ -1,59 +1,330 @@
 package htevent
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
 
 // HTDispatcher is an event htDispatcher.
 type HTDispatcher interface {
 	Handler(name string, args ...interface{}) error
+	// HandlerContext stops waiting for the listeners when ctx is done,
+	// listeners whose first argument is context.Context receive ctx.
+	HandlerContext(ctx context.Context, name string, args ...interface{}) error
 	// f is a function
-	On(name string, f interface{}) error
+	On(name string, f interface{}, opts ...ListenerOption) (Subscription, error)
+	// Once listens only the next delivery of the event.
+	Once(name string, f interface{}, opts ...ListenerOption) (Subscription, error)
+	// OnN listens the next n deliveries of the event.
+	OnN(name string, n int, f interface{}, opts ...ListenerOption) (Subscription, error)
+	// OnPriority listens with a priority, higher priorities are called first in ModeSync.
+	// A listener stops the lower priorities by returning ErrStopPropagation or calling StopPropagation.
+	OnPriority(name string, priority int, f interface{}, opts ...ListenerOption) (Subscription, error)
 	Off(name string, f interface{}) error
-	// Destroy a event
+	// Destroy a event, with its retained values, operator and metrics
 	Destroy(name string) error
+	// SetMode sets the dispatch mode of every event, including the ones created later.
+	SetMode(mode DispatchMode) error
+	// SetEventMode sets the dispatch mode of one event.
+	SetEventMode(name string, mode DispatchMode) error
+	// SetWorkerPool sets the pool shared by the events in ModePool.
+	SetWorkerPool(workers, queueSize int) error
+	// SetErrorHandler receives the listener errors of every event in ModeAsync and ModePool.
+	SetErrorHandler(f func(name string, err error)) error
+	// Request calls the responders of the event, the listeners returning values,
+	// and returns their results. See RequestMode. It goes through the middlewares,
+	// which can tell it from an emit with IsRequest.
+	Request(ctx context.Context, name string, args ...interface{}) ([]interface{}, error)
+	// SetRequestMode sets the request mode of one event, RequestSingle by default.
+	SetRequestMode(name string, mode RequestMode) error
+	// EmitSticky dispatches the event and keeps its arguments, listeners
+	// registered later are called with them at once.
+	EmitSticky(name string, args ...interface{}) error
+	// ClearSticky drops the sticky value of the event, if it has one.
+	ClearSticky(name string) error
+	// SetHistory keeps the last n deliveries of the event for the listeners registered later.
+	SetHistory(name string, n int) error
+	// Debounce delivers the event only after d without another one.
+	Debounce(name string, d time.Duration) error
+	// Throttle delivers the event at most once every interval.
+	Throttle(name string, interval time.Duration) error
+	// Coalesce merges the events emitted within window into one delivery.
+	Coalesce(name string, window time.Duration, merge MergeFunc) error
+	// ClearOperator removes the Debounce, Throttle or Coalesce of the event.
+	ClearOperator(name string) error
+	// SetClock sets the clock of the operators, for tests.
+	SetClock(c Clock) error
+	// Events returns the names of the events and wildcard subscriptions.
+	Events() []string
+	// ListenerCount returns the number of listeners of the event.
+	ListenerCount(name string) int
+	// Signature returns the most general argument types of the listeners of the event.
+	Signature(name string) ([]reflect.Type, error)
+	// Metrics returns a snapshot of the counters and latencies of every event.
+	Metrics() *MetricsSnapshot
+	// Declare fixes the argument types of the event, see Declare[T] too.
+	Declare(name string, argTypes ...reflect.Type) error
+	// SetStrict rejects the emits and subscriptions of the events not declared.
+	SetStrict(strict bool) error
+	// Docs returns the documentation of every event: signature and listeners.
+	Docs() []TopicDoc
+	// WriteDocs writes Docs as text.
+	WriteDocs(w io.Writer) error
+	// Scope returns a child dispatcher forwarding to this one, its Close removes
+	// the listeners registered through it.
+	Scope() HTDispatcher
+	// ScopeContext is Scope, closed when ctx is done.
+	ScopeContext(ctx context.Context) HTDispatcher
+	// Use adds middlewares wrapping every dispatch, typed topics included.
+	Use(mws ...Middleware)
+	// Close waits for the pending async deliveries of every event, Handler fails after it.
+	Close() error
 }
 
 type htDispatcher struct {
-	events map[string]HTEvent
-	mu     sync.RWMutex
+	events   map[string]HTEvent
+	topics   map[string]typedEvent
+	patterns *topicTrie // wildcard subscriptions
+	mu       sync.RWMutex
+
+	middlewares []Middleware
+	handler     HandlerFunc // middlewares wrapping deliver
+
+	retained *retained // sticky values and histories
+
+	operators map[string]*operator
+	clock     Clock
+
+	metrics metricsRegistry
+
+	declared map[string][]reflect.Type
+	strict   bool
+
+	mode    DispatchMode
+	pool    *workerPool
+	onError func(name string, err error)
+	closed  bool
 }
 
 // NewHTDispatcher creates a new event htDispatcher.
 func NewHTDispatcher() HTDispatcher {
-	return &htDispatcher{
-		events: map[string]HTEvent{},
+	t := &htDispatcher{
+		events:   map[string]HTEvent{},
+		topics:   map[string]typedEvent{},
+		patterns: newTopicTrie(),
+		retained: newRetained(),
+
+		operators: map[string]*operator{},
+		clock:     defaultClock,
+
+		declared: map[string][]reflect.Type{},
 	}
+	t.handler = t.deliver
+	return t
 }
 
 func (t *htDispatcher) Handler(name string, args ...interface{}) error {
+	return t.HandlerContext(context.Background(), name, args...)
+}
+
+func (t *htDispatcher) HandlerContext(ctx context.Context, name string, args ...interface{}) error {
+	return t.emit(clearEmission(ctx), name, args)
+}
+
+// dispatch through the middlewares, keeping the emission of ctx.
+func (t *htDispatcher) emit(ctx context.Context, name string, args []interface{}) error {
 	t.mu.RLock()
-	defer t.mu.RUnlock()
+	h := t.handler
+	err := t.checkDeclared(name)
+	t.mu.RUnlock()
+	if err != nil {
+		return err
+	}
 
+	return h(ctx, name, args...)
+}
+
+func (t *htDispatcher) Use(mws ...Middleware) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.middlewares = append(t.middlewares, mws...)
+	t.handler = chain(t.middlewares, t.deliver)
+}
+
+// deliver the event to the typed, reflective and wildcard listeners of name.
+func (t *htDispatcher) deliver(ctx context.Context, name string, args ...interface{}) error {
+	if isPattern(name) {
+		return fmt.Errorf("%s is a wildcard name, only concrete events can be handled", name)
+	}
+
+	t.metrics.lookup(name).emit()
+
+	if e := emissionOf(ctx); e != nil && e.request != nil {
+		// the emits of the responders aren't requests
+		var err error
+		e.request.results, err = t.respond(clearEmission(ctx), name, args...)
+		return err
+	}
+
+	t.mu.RLock()
+	op, ok := t.operators[name]
+	t.mu.RUnlock()
+	if ok {
+		return op.emit(ctx, args)
+	}
+	return t.deliverNow(ctx, name, args...)
+}
+
+// deliver the event without its operator.
+func (t *htDispatcher) deliverNow(ctx context.Context, name string, args ...interface{}) error {
+	sticky := emissionOf(ctx) != nil && emissionOf(ctx).sticky
+	ctx = clearEmission(ctx)
+
+	t.mu.RLock()
 	ev, ok := t.events[name]
-	if !ok {
+	te, tok := t.topics[name]
+	matched := t.patterns.match(name)
+	closed := t.closed
+	t.mu.RUnlock()
+
+	if closed {
+		return ErrEventClosed
+	}
+	// only the arguments the listeners can take are retained
+	if tok {
+		if err := te.validate(args); err != nil {
+			return err
+		}
+	}
+	if v, vok := ev.(validator); ok && vok {
+		if err := v.validate(args); err != nil {
+			return err
+		}
+	}
+	t.retained.record(name, args, sticky)
+	if !ok && !tok && len(matched) == 0 {
+		if sticky {
+			// kept for the listeners registered later
+			return nil
+		}
 		return newHTEventNotDefined(name)
 	}
 
-	return ev.Handler(args...)
+	// every listener is in one delivery, so the priorities and StopPropagation
+	// apply across the typed, reflective and wildcard listeners
+	var calls []call
+	var d deliverer
+	if tok {
+		calls = append(calls, te.measure(te.listenerCalls(args))...)
+		d = te
+	}
+	if ok {
+		re := ev.(*event)
+		calls = append(calls, re.measure(re.listenerCalls(args))...)
+		d = re
+	}
+	if len(matched) > 0 {
+		// wildcard listeners receive the event name before the arguments
+		named := append([]interface{}{name}, args...)
+		for _, pe := range matched {
+			pe.emitted()
+			calls = append(calls, pe.measure(pe.listenerCalls(named))...)
+		}
+		if d == nil {
+			d = matched[0]
+		}
+	}
+	sort.SliceStable(calls, func(i, j int) bool {
+		return calls[i].priority > calls[j].priority
+	})
+	return d.exec(ctx, calls, false)
+}
+
+// deliverer runs the merged calls of a delivery, in the mode of the event.
+type deliverer interface {
+	exec(ctx context.Context, calls []call, measure bool) error
+}
+
+func (t *htDispatcher) On(name string, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return t.onN(name, 0, f, opts)
+}
+
+func (t *htDispatcher) Once(name string, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return t.onN(name, 1, f, opts)
+}
+
+func (t *htDispatcher) OnN(name string, n int, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("Listen times should be positive, but got %d", n)
+	}
+	return t.onN(name, n, f, opts)
+}
+
+func (t *htDispatcher) OnPriority(name string, priority int, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return t.onN(name, 0, f, append(opts, WithPriority(priority)))
 }
 
-func (t *htDispatcher) On(name string, f interface{}) error {
+func (t *htDispatcher) onN(name string, n int, f interface{}, opts []ListenerOption) (Subscription, error) {
+	ev, sub, err := t.subscribe(name, n, f, opts)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := ev.(replayer); ok {
+		t.replay(name, r, sub)
+	}
+	return sub, nil
+}
+
+func (t *htDispatcher) subscribe(name string, n int, f interface{}, opts []ListenerOption) (HTEvent, Subscription, error) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	ev, ok := t.events[name]
-	if !ok {
-		ev = New()
-		t.events[name] = ev
+	if t.closed {
+		return nil, nil, ErrEventClosed
+	}
+	if err := t.checkDeclared(name); err != nil {
+		return nil, nil, err
+	}
+
+	var ev HTEvent
+	if isPattern(name) {
+		ev = t.patterns.get(name, func() *event {
+			pe := &event{loose: true}
+			t.inherit(name, pe)
+			return pe
+		})
+	} else {
+		var ok bool
+		ev, ok = t.events[name]
+		if !ok {
+			ev = New()
+			t.inherit(name, ev.(modeSetter))
+			t.events[name] = ev
+		}
+	}
+	var sub Subscription
+	var err error
+	if n == 0 {
+		sub, err = ev.On(f, opts...)
+	} else {
+		sub, err = ev.OnN(n, f, opts...)
 	}
-	return ev.On(f)
+	return ev, sub, err
 }
 
 func (t *htDispatcher) Off(name string, f interface{}) error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	e, ok := t.events[name]
-	if !ok {
+	e := t.event(name)
+	if e == nil {
 		return newHTEventNotDefined(name)
 	}
 
@@ -61,11 +332,190 @@ func (t *htDispatcher) Off(name string, f interface{}) error {
 }
 
 func (t *htDispatcher) Destroy(name string) error {
-	if _, ok := t.events[name]; !ok {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if isPattern(name) {
+		if !t.patterns.remove(name) {
+			return newHTEventNotDefined(name)
+		}
+		t.metrics.remove(name)
+		return nil
+	}
+
+	_, ok := t.events[name]
+	_, tok := t.topics[name]
+	if !ok && !tok {
 		return newHTEventNotDefined(name)
 	}
 	delete(t.events, name)
+	delete(t.topics, name)
+	delete(t.declared, name)
+	if op, ok := t.operators[name]; ok {
+		op.stop()
+		delete(t.operators, name)
+	}
+	t.retained.forget(name)
+	t.metrics.remove(name)
+	return nil
+}
+
+func (t *htDispatcher) SetMode(mode DispatchMode) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.mode = mode
+	t.each(func(_ string, ev modeSetter) {
+		ev.setMode(mode)
+	})
+	return nil
+}
+
+func (t *htDispatcher) SetEventMode(name string, mode DispatchMode) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	ev := t.event(name)
+	te, tok := t.topics[name]
+	if ev == nil && !tok {
+		return newHTEventNotDefined(name)
+	}
+	if ev != nil {
+		ev.SetMode(mode)
+	}
+	if tok {
+		te.setMode(mode)
+	}
 	return nil
 }
 
+func (t *htDispatcher) SetWorkerPool(workers, queueSize int) error {
+	t.mu.Lock()
+	old := t.pool
+	t.pool = newWorkerPool(workers, queueSize)
+	t.each(func(_ string, ev modeSetter) {
+		ev.setPool(t.pool, false)
+	})
+	t.mu.Unlock()
+
+	// no event submits to the old pool any more, let the queued calls finish.
+	// listeners may use the dispatcher, so it's done without the lock.
+	if old != nil {
+		old.close()
+	}
+	return nil
+}
+
+func (t *htDispatcher) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	for _, op := range t.operators {
+		op.stop()
+	}
+	events := make([]modeSetter, 0, len(t.events)+len(t.topics))
+	t.each(func(_ string, ev modeSetter) {
+		events = append(events, ev)
+	})
+	pool := t.pool
+	t.mu.Unlock()
+
+	for _, ev := range events {
+		ev.close()
+	}
+	if pool != nil {
+		pool.close()
+	}
+	return nil
+}
+
+func (t *htDispatcher) SetErrorHandler(f func(name string, err error)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.onError = f
+	t.each(func(name string, ev modeSetter) {
+		ev.setErrorHandler(t.errorHandler(name))
+	})
+	return nil
+}
+
+// apply the dispatcher mode, pool and error handler to a new event.
+func (t *htDispatcher) inherit(name string, ev modeSetter) {
+	ev.setMode(t.mode)
+	if t.pool != nil {
+		ev.setPool(t.pool, false)
+	}
+	ev.setErrorHandler(t.errorHandler(name))
+	ev.setMetrics(t.metrics.get(name))
+}
+
+// report an error of a delivery nobody waits for.
+func (t *htDispatcher) report(name string, err error) {
+	t.mu.RLock()
+	f := t.onError
+	t.mu.RUnlock()
+	if f == nil {
+		fmt.Fprintf(os.Stderr, "htevent: %s\n", err)
+		return
+	}
+	f(name, err)
+}
+
+func (t *htDispatcher) errorHandler(name string) func(err error) {
+	f := t.onError
+	if f == nil {
+		return nil
+	}
+	return func(err error) {
+		f(name, err)
+	}
+}
+
+// return the reflective event or wildcard subscription of name, nil if it doesn't exist.
+func (t *htDispatcher) event(name string) HTEvent {
+	if isPattern(name) {
+		if pe := t.patterns.get(name, nil); pe != nil {
+			return pe
+		}
+		return nil
+	}
+	if ev, ok := t.events[name]; ok {
+		return ev
+	}
+	return nil
+}
+
+// call f with every reflective, typed and wildcard event.
+func (t *htDispatcher) each(f func(name string, ev modeSetter)) {
+	for name, ev := range t.events {
+		f(name, ev.(modeSetter))
+	}
+	for name, te := range t.topics {
+		f(name, te)
+	}
+	t.patterns.each(func(pattern string, pe *event) {
+		f(pattern, pe)
+	})
+}
+
+// return the typed event of name, created by create if it's missing.
+func (t *htDispatcher) typedTopic(name string, create func() typedEvent) (typedEvent, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := t.checkDeclared(name); err != nil {
+		return nil, err
+	}
+	te, ok := t.topics[name]
+	if !ok {
+		te = create()
+		if declared, ok := t.declared[name]; ok && !reflect.DeepEqual(declared, te.signature()) {
+			return nil, fmt.Errorf("%s is declared as %v", name, declared)
+		}
+		t.inherit(name, te)
+		t.topics[name] = te
+	}
+	return te, nil
+}
+
 var _ HTDispatcher = &htDispatcher{}
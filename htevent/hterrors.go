@@ -1,6 +1,18 @@
 package htevent
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrEventClosed is returned when handling an event after Close.
+var ErrEventClosed = errors.New("event has been closed")
+
+// ErrStopPropagation returned by a listener in ModeSync stops the delivery
+// to the listeners of lower priority. It isn't reported as a listener error,
+// wrap it to report a reason: fmt.Errorf("no auth: %w", ErrStopPropagation).
+var ErrStopPropagation = errors.New("stop propagation")
 
 // HTEventNotDefined is an error indicationg that the event has not been defined.
 type HTEventNotDefined struct {
@@ -24,3 +36,95 @@ func (e *HTEventNotDefined) HTEventName() string {
 
 var _ error = newHTEventNotDefined("none f")
 
+// HTEventNotDeclared is an error indicating that a strict dispatcher got an event not declared.
+type HTEventNotDeclared struct {
+	name string
+}
+
+func newHTEventNotDeclared(name string) *HTEventNotDeclared {
+	return &HTEventNotDeclared{
+		name: name,
+	}
+}
+
+func (e *HTEventNotDeclared) Error() string {
+	return fmt.Sprintf("%s event has not been declared.", e.name)
+}
+
+// HTEventName return name of the event.
+func (e *HTEventNotDeclared) HTEventName() string {
+	return e.name
+}
+
+// ListenerError is the failure of one listener.
+type ListenerError struct {
+	// Index of the listener in delivery order, by priority then registration.
+	Index int
+	// Err is the error returned by the listener, or a *PanicError.
+	Err error
+}
+
+func (e *ListenerError) Error() string {
+	return fmt.Sprintf("listener[%d]: %s", e.Index, e.Err)
+}
+
+func (e *ListenerError) Unwrap() error {
+	return e.Err
+}
+
+// ListenerErrors is returned by Handler when some listeners failed.
+type ListenerErrors []*ListenerError
+
+func (e ListenerErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, le := range e {
+		msgs = append(msgs, le.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap lets errors.Is and errors.As look into every listener error.
+func (e ListenerErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, le := range e {
+		errs = append(errs, le)
+	}
+	return errs
+}
+
+// return nil for an empty ListenerErrors, so callers can compare with nil.
+func (e ListenerErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// join the errors of several events, a single error is returned as it is.
+func joinErrors(errs []error) error {
+	var nonNil []error
+	for _, err := range errs {
+		if err != nil {
+			nonNil = append(nonNil, err)
+		}
+	}
+	switch len(nonNil) {
+	case 0:
+		return nil
+	case 1:
+		return nonNil[0]
+	}
+	return errors.Join(nonNil...)
+}
+
+// PanicError is a listener panic recovered by the event.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("listener panic: %v", e.Value)
+}
+
+var _ error = ListenerErrors{}
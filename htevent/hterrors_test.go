@@ -0,0 +1,50 @@
+package htevent
+
+import (
+	"errors"
+	"testing"
+)
+
+// a panicking listener doesn't stop the others, its panic and the errors are
+// returned with the index of the listener.
+func TestListenerErrors(t *testing.T) {
+	for _, mode := range []DispatchMode{ModeSync, ModeConcurrent} {
+		d := NewHTDispatcher()
+		d.SetMode(mode)
+		boom := errors.New("boom")
+		var called int32
+		d.On("job", func() error { return nil })
+		d.On("job", func() error { return boom })
+		d.On("job", func() { panic("crash") })
+		d.On("job", func() { called = 1 })
+
+		err := d.Handler("job")
+		var errs ListenerErrors
+		if !errors.As(err, &errs) || len(errs) != 2 {
+			t.Fatalf("mode %v: got %v, want 2 listener errors", mode, err)
+		}
+		if errs[0].Index != 1 || errs[0].Err != boom {
+			t.Fatalf("mode %v: got %v, want listener[1]: boom", mode, errs[0])
+		}
+		var pe *PanicError
+		if errs[1].Index != 2 || !errors.As(errs[1], &pe) || pe.Value != "crash" || len(pe.Stack) == 0 {
+			t.Fatalf("mode %v: got %v, want the panic of listener[2]", mode, errs[1])
+		}
+		if !errors.Is(err, boom) {
+			t.Fatalf("mode %v: errors.Is(err, boom) is false", mode)
+		}
+		if called != 1 {
+			t.Fatalf("mode %v: the last listener wasn't called", mode)
+		}
+	}
+}
+
+// Handler returns nil when every listener succeeds.
+func TestListenerErrorsNil(t *testing.T) {
+	d := NewHTDispatcher()
+	d.On("job", func() error { return nil })
+	d.On("job", func(...interface{}) {})
+	if err := d.Handler("job"); err != nil {
+		t.Fatalf("got %v, want nil", err)
+	}
+}
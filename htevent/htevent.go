@@ -1,26 +1,73 @@
 package htevent
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"sync"
+	"time"
 )
 
 // HTEvent is an event.
 type HTEvent interface {
 	Handler(args ...interface{}) error
+	// HandlerContext stops waiting for the listeners when ctx is done,
+	// listeners whose first argument is context.Context receive ctx.
+	HandlerContext(ctx context.Context, args ...interface{}) error
 	// f is a function
-	On(f interface{}) error
+	On(f interface{}, opts ...ListenerOption) (Subscription, error)
+	// Once listens only the next delivery, the listener is removed after it.
+	Once(f interface{}, opts ...ListenerOption) (Subscription, error)
+	// OnN listens the next n deliveries.
+	OnN(n int, f interface{}, opts ...ListenerOption) (Subscription, error)
+	// OnPriority listens with a priority, higher priorities are called first in ModeSync.
+	OnPriority(priority int, f interface{}, opts ...ListenerOption) (Subscription, error)
 	Off(f interface{}) error
+	// SetMode changes how the listeners are called, ModeConcurrent by default.
+	SetMode(mode DispatchMode)
+	// SetWorkerPool sets the pool used by ModePool. workers <= 0 means runtime.NumCPU(),
+	// queueSize < 0 means the default queue size.
+	SetWorkerPool(workers, queueSize int)
+	// SetErrorHandler receives the errors and panics of the listeners
+	// called in ModeAsync and ModePool, they are printed to stderr by default.
+	SetErrorHandler(f func(err error))
+	// Request calls the responders, the listeners returning values,
+	// and returns their results according to the request mode.
+	Request(ctx context.Context, args ...interface{}) ([]interface{}, error)
+	// SetRequestMode changes how Request calls the responders, RequestSingle by default.
+	SetRequestMode(mode RequestMode)
+	// Close waits for the pending async deliveries, Handler fails after it.
+	Close() error
 }
 
 type event struct {
 	// listeners are listener functions.
-	listeners []reflect.Value
+	listeners []*listener
 	lmu       sync.RWMutex
 
+	// argTypes are the most general argument types of the listeners.
 	argTypes []reflect.Type
-	tmu      sync.RWMutex
+	variadic bool
+	declared bool // argTypes are declared, listeners don't change them
+	// resultTypes are the results of the responders, without the trailing error.
+	resultTypes []reflect.Type
+	tmu         sync.RWMutex
+
+	// loose events don't lock a signature, each listener only receives
+	// the arguments it can take. Used by wildcard subscriptions.
+	loose bool
+
+	requestMode RequestMode
+
+	dispatch
+}
+
+type listener struct {
+	fn       reflect.Value
+	withCtx  bool // first argument is context.Context
+	timeout  time.Duration
+	priority int
+	counter
 }
 
 // New creates a new event.
@@ -31,7 +78,19 @@ func New() HTEvent {
 var _ HTEvent = New()
 
 func (p *event) Handler(args ...interface{}) error {
+	return p.HandlerContext(context.Background(), args...)
+}
 
+func (p *event) HandlerContext(ctx context.Context, args ...interface{}) error {
+	if err := p.validate(args); err != nil {
+		return err
+	}
+	return p.run(ctx, p.listenerCalls(args))
+}
+
+// return the calls of the listeners taking args, by priority.
+// The Once and OnN listeners reaching their count are removed.
+func (p *event) listenerCalls(args []interface{}) []call {
 	arguments := make([]reflect.Value, 0, len(args))
 	argTypes := make([]reflect.Type, 0, len(args))
 	for _, v := range args {
@@ -39,42 +98,122 @@ func (p *event) Handler(args ...interface{}) error {
 		argTypes = append(argTypes, reflect.TypeOf(v))
 	}
 
-	err := p.validateArgs(argTypes)
-	if err != nil {
-		return err
+	p.lmu.RLock()
+	calls := make([]call, 0, len(p.listeners))
+	var done []uint64
+	for _, l := range p.listeners {
+		// listeners narrower than the signature only receive the arguments they can take
+		if !fits(l.fn.Type(), argTypes) {
+			continue
+		}
+		ok, last := l.take()
+		if !ok {
+			continue
+		}
+		if last {
+			done = append(done, l.id)
+		}
+		calls = append(calls, call{fn: l.call(arguments), timeout: l.timeout, priority: l.priority})
 	}
+	p.lmu.RUnlock()
 
-	p.lmu.RLock()
-	defer p.lmu.RUnlock()
+	for _, id := range done {
+		p.remove(id)
+	}
+	return calls
+}
 
-	wg := sync.WaitGroup{}
-	wg.Add(len(p.listeners))
-	for _, fn := range p.listeners {
-		go func(f reflect.Value) {
-			defer wg.Done()
-			f.Call(arguments)
-		}(fn)
+// return the call of the listener with arguments.
+func (l *listener) call(arguments []reflect.Value) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return callErr(l.fn.Call(l.in(ctx, arguments)))
 	}
+}
+
+// return the input of the listener, with ctx if it takes one.
+func (l *listener) in(ctx context.Context, arguments []reflect.Value) []reflect.Value {
+	in := make([]reflect.Value, 0, len(arguments)+1)
+	if l.withCtx {
+		in = append(in, reflect.ValueOf(&ctx).Elem())
+	}
+	fnType := l.fn.Type()
+	for _, a := range arguments {
+		if !a.IsValid() {
+			// untyped nil argument
+			a = reflect.Zero(paramType(fnType, len(in)))
+		}
+		in = append(in, a)
+	}
+	return in
+}
 
-	wg.Wait()
+func (p *event) SetMode(mode DispatchMode) {
+	p.setMode(mode)
+}
+
+func (p *event) SetWorkerPool(workers, queueSize int) {
+	p.setWorkerPool(workers, queueSize)
+}
+
+func (p *event) SetErrorHandler(f func(err error)) {
+	p.setErrorHandler(f)
+}
+
+func (p *event) Close() error {
+	p.close()
 	return nil
 }
 
 // Start to listen an event.
-func (p *event) On(f interface{}) error {
+func (p *event) On(f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return p.onN(0, f, opts)
+}
+
+// Listen an event only once.
+func (p *event) Once(f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return p.onN(1, f, opts)
+}
+
+// Listen an event n times.
+func (p *event) OnN(n int, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("Listen times should be positive, but got %d", n)
+	}
+	return p.onN(n, f, opts)
+}
+
+// Listen an event with a priority.
+func (p *event) OnPriority(priority int, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return p.onN(0, f, append(opts, WithPriority(priority)))
+}
+
+func (p *event) onN(n int, f interface{}, opts []ListenerOption) (Subscription, error) {
 	fn, err := p.checkFuncSignature(f)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	cfg := newListenerConfig(opts)
+	l := &listener{
+		fn:       *fn,
+		withCtx:  hasCtxArg(fn.Type()),
+		timeout:  cfg.timeout,
+		priority: cfg.priority,
+		counter:  newCounter(n),
+	}
 	p.lmu.Lock()
 	defer p.lmu.Unlock()
-	p.listeners = append(p.listeners, *fn)
+	p.listeners = insertByPriority(p.listeners, l, func(l *listener) int {
+		return l.priority
+	})
 
-	return nil
+	return l.subscription(func() bool {
+		return p.remove(l.id)
+	}), nil
 }
 
 // Stop listening an event.
+// Closures can't be compared reliably, use Subscription.Unsubscribe for them.
 func (p *event) Off(f interface{}) error {
 	fn := reflect.ValueOf(f)
 
@@ -83,7 +222,7 @@ func (p *event) Off(f interface{}) error {
 	l := len(p.listeners)
 	m := l // for error check
 	for i := 0; i < l; i++ {
-		if fn == p.listeners[i] {
+		if fn == p.listeners[i].fn {
 			// XXX: GC Ref: http://jxck.hatenablog.com/entry/golang-slice-internals
 			p.listeners = append(p.listeners[:i], p.listeners[i+1:]...)
 			l--
@@ -97,6 +236,54 @@ func (p *event) Off(f interface{}) error {
 	return nil
 }
 
+// deliver args to the listener of id only, like a delivery in ModeSync.
+func (p *event) replay(ctx context.Context, id uint64, args []interface{}) error {
+	var l *listener
+	p.lmu.RLock()
+	for _, o := range p.listeners {
+		if o.id == id {
+			l = o
+			break
+		}
+	}
+	p.lmu.RUnlock()
+	if l == nil {
+		return nil
+	}
+
+	arguments := make([]reflect.Value, 0, len(args))
+	argTypes := make([]reflect.Type, 0, len(args))
+	for _, v := range args {
+		arguments = append(arguments, reflect.ValueOf(v))
+		argTypes = append(argTypes, reflect.TypeOf(v))
+	}
+	if !fits(l.fn.Type(), argTypes) {
+		return fmt.Errorf("Listener can't take the arguments %v", argTypes)
+	}
+
+	ok, last := l.take()
+	if !ok {
+		return nil
+	}
+	if last {
+		p.remove(id)
+	}
+	return ignoreStop(call{fn: l.call(arguments), timeout: l.timeout}.invoke(ctx))
+}
+
+// remove the listener of id, return false if it doesn't exist.
+func (p *event) remove(id uint64) bool {
+	p.lmu.Lock()
+	defer p.lmu.Unlock()
+	for i, l := range p.listeners {
+		if l.id == id {
+			p.listeners = append(p.listeners[:i], p.listeners[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
 // retrun function as reflect.Value
 // retrun error if f isn't function, argument is invalid
 func (p *event) checkFuncSignature(f interface{}) (*reflect.Value, error) {
@@ -107,16 +294,52 @@ func (p *event) checkFuncSignature(f interface{}) (*reflect.Value, error) {
 
 	types := fnArgTypes(fn)
 
+	if p.loose {
+		if len(types) == 0 || types[0].Kind() != reflect.String {
+			return nil, fmt.Errorf("Wildcard listener should take the event name string as first argument")
+		}
+		return &fn, nil
+	}
+
+	results := fnResultTypes(fn)
+	variadic := fn.Type().IsVariadic()
+
 	p.lmu.RLock()
 	defer p.lmu.RUnlock()
+
+	p.tmu.RLock()
+	declared, argTypes := p.declared, p.argTypes
+	p.tmu.RUnlock()
+	if declared {
+		if !fits(fn.Type(), argTypes) {
+			return nil, fmt.Errorf("Argument Error. Listener can't take the declared arguments %v", argTypes)
+		}
+		if len(p.listeners) == 0 {
+			p.tmu.Lock()
+			defer p.tmu.Unlock()
+			p.resultTypes = results
+			return &fn, nil
+		}
+		if err := p.validateResults(results); err != nil {
+			return nil, err
+		}
+		return &fn, nil
+	}
+
 	if len(p.listeners) == 0 {
 		p.tmu.Lock()
 		defer p.tmu.Unlock()
 		p.argTypes = types
+		p.variadic = variadic
+		p.resultTypes = results
 		return &fn, nil
 	}
 
-	err := p.validateArgs(types)
+	err := p.validateResults(results)
+	if err != nil {
+		return nil, err
+	}
+	err = p.generalize(types, variadic)
 	if err != nil {
 		return nil, err
 	}
@@ -124,30 +347,166 @@ func (p *event) checkFuncSignature(f interface{}) (*reflect.Value, error) {
 	return &fn, nil
 }
 
-// if argument size or type are different return error.
+// validator is an event checking arguments before they are delivered.
+type validator interface {
+	validate(args []interface{}) error
+}
+
+// validate checks the arguments can be passed to the signature.
+func (p *event) validate(args []interface{}) error {
+	if p.loose {
+		return nil
+	}
+	argTypes := make([]reflect.Type, 0, len(args))
+	for _, v := range args {
+		argTypes = append(argTypes, reflect.TypeOf(v))
+	}
+	return p.validateArgs(argTypes)
+}
+
+// if arguments can't be passed to the signature return error.
+// A nil type is an untyped nil argument.
 func (p *event) validateArgs(types []reflect.Type) error {
 	p.tmu.RLock()
 	defer p.tmu.RUnlock()
+	n := len(p.argTypes)
+	if p.variadic {
+		if len(types) < n-1 {
+			return fmt.Errorf("Argument length expected at least %d, but got %d", n-1, len(types))
+		}
+	} else if len(types) != n {
+		return fmt.Errorf("Argument length expected %d, but got %d", n, len(types))
+	}
+	for i, t := range types {
+		want := p.argTypes[min(i, n-1)]
+		if p.variadic && i >= n-1 {
+			want = want.Elem()
+		}
+		if !assignable(t, want) {
+			return fmt.Errorf("Argument Error. Args[%d] expected %s, but got %s", i, want, typeString(t))
+		}
+	}
+
+	return nil
+}
+
+// merge the argument types of a new listener into the signature, keeping the
+// most general type of each argument. Unrelated types return error.
+func (p *event) generalize(types []reflect.Type, variadic bool) error {
+	p.tmu.Lock()
+	defer p.tmu.Unlock()
 	if len(types) != len(p.argTypes) {
 		return fmt.Errorf("Argument length expected %d, but got %d", len(p.argTypes), len(types))
 	}
+	if variadic != p.variadic {
+		return fmt.Errorf("Listener should be variadic like the others: %t, but got %t", p.variadic, variadic)
+	}
+
+	merged := make([]reflect.Type, len(types))
 	for i, t := range types {
-		if t != p.argTypes[i] {
-			return fmt.Errorf("Argument Error. Args[%d] expected %s, but got %s", i, p.argTypes[i], t)
+		locked := p.argTypes[i]
+		variadicArg := variadic && i == len(types)-1
+		if variadicArg {
+			// compare the elements, []*MyErr isn't assignable to []error
+			t, locked = t.Elem(), locked.Elem()
+		}
+		switch {
+		case locked.AssignableTo(t):
+			merged[i] = t
+		case t.AssignableTo(locked):
+			merged[i] = locked
+		default:
+			return fmt.Errorf("Argument Error. Args[%d] expected %s, but got %s", i, locked, t)
+		}
+		if variadicArg {
+			merged[i] = reflect.SliceOf(merged[i])
 		}
 	}
-
+	p.argTypes = merged
 	return nil
 }
 
-// return argument types.
+func typeString(t reflect.Type) string {
+	if t == nil {
+		return "nil"
+	}
+	return t.String()
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// return the error of a listener whose last result is error.
+func callErr(out []reflect.Value) error {
+	n := len(out)
+	if n == 0 || out[n-1].Type() != errorType || out[n-1].IsNil() {
+		return nil
+	}
+	return out[n-1].Interface().(error)
+}
+
+// whether a function of fnType can be called with arguments of types,
+// a nil type is an untyped nil argument.
+func fits(fnType reflect.Type, types []reflect.Type) bool {
+	offset := 0
+	if hasCtxArg(fnType) {
+		offset = 1
+	}
+	n := fnType.NumIn() - offset
+	if fnType.IsVariadic() {
+		if len(types) < n-1 {
+			return false
+		}
+	} else if len(types) != n {
+		return false
+	}
+
+	for i, t := range types {
+		if !assignable(t, paramType(fnType, i+offset)) {
+			return false
+		}
+	}
+	return true
+}
+
+// return the type of the i-th argument, the element type for variadic arguments.
+func paramType(fnType reflect.Type, i int) reflect.Type {
+	if fnType.IsVariadic() && i >= fnType.NumIn()-1 {
+		return fnType.In(fnType.NumIn() - 1).Elem()
+	}
+	return fnType.In(i)
+}
+
+// whether a value of type t can be passed as p, a nil t is an untyped nil.
+func assignable(t, p reflect.Type) bool {
+	if t == nil {
+		switch p.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			return true
+		}
+		return false
+	}
+	return t.AssignableTo(p)
+}
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// whether the first argument of the function is context.Context.
+func hasCtxArg(fnType reflect.Type) bool {
+	return fnType.NumIn() > 0 && fnType.In(0) == contextType
+}
+
+// return argument types, without the leading context.Context.
 func fnArgTypes(fn reflect.Value) []reflect.Type {
 	fnType := fn.Type()
 	fnNum := fnType.NumIn()
 
 	types := make([]reflect.Type, 0, fnNum)
 
-	for i := 0; i < fnNum; i++ {
+	i := 0
+	if hasCtxArg(fnType) {
+		i = 1
+	}
+	for ; i < fnNum; i++ {
 		types = append(types, fnType.In(i))
 	}
 
@@ -0,0 +1,92 @@
+package htevent
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type argErr struct{}
+
+func (*argErr) Error() string { return "my error" }
+
+// an argument is valid when it's assignable, the signature keeps the most general type.
+func TestAssignableArguments(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+	var narrow, general []error
+	d.On("failed", func(e *argErr) { narrow = append(narrow, e) })
+	d.On("failed", func(err error) { general = append(general, err) })
+
+	sig, err := d.Signature("failed")
+	if err != nil || len(sig) != 1 || sig[0] != errorType {
+		t.Fatalf("got signature %v %v, want [error]", sig, err)
+	}
+	if err := d.Handler("failed", &argErr{}); err != nil {
+		t.Fatal(err)
+	}
+	// the narrow listener can't take another error, it isn't called
+	if err := d.Handler("failed", errors.New("other")); err != nil {
+		t.Fatal(err)
+	}
+	if len(narrow) != 1 || len(general) != 2 {
+		t.Fatalf("got %d narrow and %d general calls, want 1 and 2", len(narrow), len(general))
+	}
+
+	if _, err := d.On("failed", func(s string) {}); err == nil {
+		t.Fatal("an unrelated listener was registered")
+	}
+	if err := d.Handler("failed", "str"); err == nil {
+		t.Fatal("a string was emitted to func(error)")
+	}
+}
+
+// an untyped nil is valid for the nilable argument types only.
+func TestNilArguments(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+	var got []interface{}
+	d.On("nils", func(p *int, m map[string]int, s []int, e error, f func()) {
+		got = append(got, p == nil, m == nil, s == nil, e == nil, f == nil)
+	})
+	if err := d.Handler("nils", nil, nil, nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []interface{}{true, true, true, true, true}) {
+		t.Fatalf("got %v", got)
+	}
+
+	d.On("count", func(int) {})
+	err := d.Handler("count", nil)
+	if err == nil || !strings.Contains(err.Error(), "expected int, but got nil") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// variadic listeners take any number of trailing arguments.
+func TestVariadicListener(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+	var got []int
+	d.On("sum", func(prefix string, n ...int) { got = append(got, len(n)) })
+	d.On("sum", func(prefix string, n ...int) {})
+
+	for _, args := range [][]interface{}{{"a"}, {"a", 1}, {"a", 1, 2, 3}} {
+		if err := d.Handler("sum", args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(got, []int{0, 1, 3}) {
+		t.Fatalf("got %v, want [0 1 3]", got)
+	}
+	if err := d.Handler("sum", "a", "b"); err == nil {
+		t.Fatal("a string was emitted as a variadic int")
+	}
+	if err := d.Handler("sum"); err == nil {
+		t.Fatal("the prefix is missing but the emit succeeded")
+	}
+	if _, err := d.On("sum", func(prefix string, n []int) {}); err == nil {
+		t.Fatal("a non variadic listener was registered next to variadic ones")
+	}
+}
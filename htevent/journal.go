@@ -0,0 +1,501 @@
+package htevent
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htfile"
+)
+
+// JournalFormat is the encoding of the journal records.
+type JournalFormat int
+
+const (
+	// JournalJSON writes one JSON record per line, after its length and checksum.
+	// Arguments are read back as generic JSON values, unless their types are set by SetArgTypes.
+	JournalJSON JournalFormat = iota
+	// JournalGob writes gob records after their length and checksum, the argument
+	// types have to be registered with gob.Register.
+	JournalGob
+)
+
+// errCorruptRecord is a complete record failing its checksum, it's skipped.
+var errCorruptRecord = errors.New("corrupt record")
+
+// JournalRecord is an event of the journal.
+type JournalRecord struct {
+	Seq  uint64 // increasing from 1, across restarts
+	Time time.Time
+	Name string
+	Args []interface{}
+}
+
+// Journal appends the events to time-cut files of htfile, to replay them after a restart.
+// Use its Middleware to record every dispatch of a dispatcher.
+type Journal struct {
+	filename string
+	format   JournalFormat
+	file     *htfile.HTFile
+	cutType  htfile.TCut
+	argTypes map[string][]reflect.Type
+	seq      uint64
+	mu       sync.Mutex
+
+	offsets map[string]uint64 // the last seq handled by each consumer
+	omu     sync.Mutex
+}
+
+// OpenJournal opens the journal of filename, the files are filename.<time>,
+// cut by day. The offsets of the consumers are kept in filename-offsets.json.
+func OpenJournal(filename string, format JournalFormat) (*Journal, error) {
+	j := &Journal{
+		filename: filename,
+		format:   format,
+		file:     htfile.Open(filename),
+		argTypes: map[string][]reflect.Type{},
+		offsets:  map[string]uint64{},
+	}
+	j.SetCutType(htfile.CutTypeDay)
+
+	if err := j.loadOffsets(); err != nil {
+		return nil, err
+	}
+
+	// continue the sequence of the last record, the file appended next
+	// loses the record torn by a crash
+	files, err := j.files()
+	if err != nil {
+		return nil, err
+	}
+	for i := len(files) - 1; i >= 0 && j.seq == 0; i-- {
+		read := j.readFile
+		if i == len(files)-1 && !strings.HasSuffix(files[i], ".gz") {
+			read = j.repairFile
+		}
+		err := read(files[i], func(rec *JournalRecord) error {
+			j.seq = rec.Seq
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return j, nil
+}
+
+// SetCutType sets how the files are cut, htfile.CutTypeDay by default.
+func (j *Journal) SetCutType(cutType htfile.TCut) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.cutType = cutType
+	j.file.SetFormat(cutType)
+}
+
+// SetRetention sets the retention of the journal files.
+func (j *Journal) SetRetention(r *htfile.Retention) {
+	j.file.SetRetention(r)
+}
+
+// SetArgTypes sets the argument types of an event read from a JournalJSON journal,
+// by sample values.
+func (j *Journal) SetArgTypes(name string, samples ...interface{}) {
+	types := make([]reflect.Type, 0, len(samples))
+	for _, s := range samples {
+		types = append(types, reflect.TypeOf(s))
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.argTypes[name] = types
+}
+
+// Append writes an event to the journal.
+func (j *Journal) Append(name string, args ...interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	rec := &JournalRecord{Seq: j.seq + 1, Time: time.Now(), Name: name, Args: args}
+	b, err := j.encode(rec)
+	if err != nil {
+		return fmt.Errorf("Journal %s: %s", name, err)
+	}
+	if _, err := j.file.Writeb(b); err != nil {
+		return err
+	}
+	j.seq = rec.Seq
+	return nil
+}
+
+// Middleware appends every dispatch to the journal before delivering it.
+// The event isn't delivered if it can't be written. Replayed events aren't appended again.
+func (j *Journal) Middleware(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, name string, args ...interface{}) error {
+		if !IsReplay(ctx) && !IsRequest(ctx) {
+			if err := j.Append(name, args...); err != nil {
+				return err
+			}
+		}
+		return next(ctx, name, args...)
+	}
+}
+
+type replayKey struct{}
+
+// IsReplay reports whether the event is replayed from a journal,
+// listeners may skip their side effects for it.
+func IsReplay(ctx context.Context) bool {
+	return ctx.Value(replayKey{}) != nil
+}
+
+// Replay calls handler with the events appended since from, in order.
+// handler may be the HandlerContext of a dispatcher, ctx is marked by IsReplay.
+// It stops at the first error of handler.
+func (j *Journal) Replay(from time.Time, handler HandlerFunc) error {
+	return j.replay(func(rec *JournalRecord) bool {
+		return !rec.Time.Before(from)
+	}, from, func(rec *JournalRecord) error {
+		return j.deliver(rec, handler)
+	})
+}
+
+// Consume calls handler with the events the consumer hasn't handled yet,
+// then saves its offset. A late subscriber catches up this way before listening.
+// On an error of handler the offset stays at the last handled event.
+func (j *Journal) Consume(consumer string, handler HandlerFunc) error {
+	offset := j.Offset(consumer)
+	last := offset
+	err := j.replay(func(rec *JournalRecord) bool {
+		return rec.Seq > offset
+	}, time.Time{}, func(rec *JournalRecord) error {
+		if err := j.deliver(rec, handler); err != nil {
+			return err
+		}
+		last = rec.Seq
+		return nil
+	})
+
+	if last != offset {
+		if cerr := j.Commit(consumer, last); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Offset returns the seq of the last event handled by the consumer, 0 if none.
+func (j *Journal) Offset(consumer string) uint64 {
+	j.omu.Lock()
+	defer j.omu.Unlock()
+	return j.offsets[consumer]
+}
+
+// Commit saves the offset of the consumer.
+func (j *Journal) Commit(consumer string, seq uint64) error {
+	j.omu.Lock()
+	defer j.omu.Unlock()
+	j.offsets[consumer] = seq
+	return j.saveOffsets()
+}
+
+// Close closes the current file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	err := j.file.Close()
+	if errors.Is(err, os.ErrInvalid) {
+		// nothing was written
+		return nil
+	}
+	return err
+}
+
+func (j *Journal) deliver(rec *JournalRecord, handler HandlerFunc) error {
+	ctx := context.WithValue(context.Background(), replayKey{}, rec)
+	return handler(ctx, rec.Name, rec.Args...)
+}
+
+// read the records of every file passing keep, files ending before from are skipped.
+func (j *Journal) replay(keep func(rec *JournalRecord) bool, from time.Time, f func(rec *JournalRecord) error) error {
+	files, err := j.files()
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	cutType := string(j.cutType)
+	j.mu.Unlock()
+
+	for i, name := range files {
+		// the next file starts before from, so this one ends before it
+		if i+1 < len(files) {
+			if start, ok := fileStart(j.filename, files[i+1], cutType); ok && !start.After(from) {
+				continue
+			}
+		}
+
+		err := j.readFile(name, func(rec *JournalRecord) error {
+			if !keep(rec) {
+				return nil
+			}
+			return f(rec)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// return the journal files, oldest first.
+func (j *Journal) files() ([]string, error) {
+	files, err := filepath.Glob(j.filename + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// return the time the file was started, from its key.
+func fileStart(filename, name, cutType string) (time.Time, bool) {
+	key := strings.TrimSuffix(strings.TrimPrefix(name, filename+"."), ".gz")
+	t, err := time.ParseInLocation(cutType, key, time.Local)
+	return t, err == nil
+}
+
+// call f with every record of the file, gzip files included.
+// A truncated last record, being written, is ignored.
+func (j *Journal) readFile(name string, f func(rec *JournalRecord) error) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	_, err = j.scan(name, r, f)
+	return err
+}
+
+// readFile for the file appended next: a truncated last record, torn by a crash,
+// is cut off so the next record doesn't follow it.
+func (j *Journal) repairFile(name string, f func(rec *JournalRecord) error) error {
+	file, err := os.OpenFile(name, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	size, err := j.scan(name, file, f)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() > size {
+		fmt.Fprintf(os.Stderr, "htevent: journal %s: cut a torn record of %d bytes\n", name, info.Size()-size)
+		return file.Truncate(size)
+	}
+	return nil
+}
+
+// call f with the records of r, corrupt records are skipped. It returns
+// the size of the complete records, a truncated last record excluded.
+func (j *Journal) scan(name string, r io.Reader, f func(rec *JournalRecord) error) (int64, error) {
+	br := bufio.NewReader(r)
+	var size int64
+	for {
+		rec, n, err := j.decode(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, nil
+		}
+		size += int64(n)
+		if errors.Is(err, errCorruptRecord) {
+			fmt.Fprintf(os.Stderr, "htevent: journal %s: skipped %s\n", name, err)
+			continue
+		}
+		if err != nil {
+			return size, fmt.Errorf("%s: %s", name, err)
+		}
+		if err := f(rec); err != nil {
+			return size, err
+		}
+	}
+}
+
+// jsonRecord is JournalRecord on the wire of JournalJSON.
+type jsonRecord struct {
+	Seq  uint64            `json:"seq"`
+	Time time.Time         `json:"time"`
+	Name string            `json:"name"`
+	Args []json.RawMessage `json:"args"`
+}
+
+// encode a record after its length and crc32 checksum:
+// 8 bytes in JournalGob, "%08x %08x " in JournalJSON.
+func (j *Journal) encode(rec *JournalRecord) ([]byte, error) {
+	if j.format == JournalGob {
+		var buf bytes.Buffer
+		buf.Write(make([]byte, 8))
+		if err := gob.NewEncoder(&buf).Encode(rec); err != nil {
+			return nil, err
+		}
+		b := buf.Bytes()
+		binary.BigEndian.PutUint32(b, uint32(len(b)-8))
+		binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[8:]))
+		return b, nil
+	}
+
+	b, err := json.Marshal(struct {
+		Seq  uint64        `json:"seq"`
+		Time time.Time     `json:"time"`
+		Name string        `json:"name"`
+		Args []interface{} `json:"args"`
+	}{rec.Seq, rec.Time, rec.Name, rec.Args})
+	if err != nil {
+		return nil, err
+	}
+	line := fmt.Appendf(nil, "%08x %08x ", len(b), crc32.ChecksumIEEE(b))
+	line = append(line, b...)
+	return append(line, '\n'), nil
+}
+
+// decode the next record and return its size. A complete record failing
+// its checksum is errCorruptRecord, a truncated one io.ErrUnexpectedEOF.
+func (j *Journal) decode(r *bufio.Reader) (*JournalRecord, int, error) {
+	if j.format == JournalGob {
+		var head [8]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			return nil, 0, err
+		}
+		b := make([]byte, binary.BigEndian.Uint32(head[:4]))
+		if _, err := io.ReadFull(r, b); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, 0, err
+		}
+		n := len(head) + len(b)
+		if crc32.ChecksumIEEE(b) != binary.BigEndian.Uint32(head[4:]) {
+			return nil, n, fmt.Errorf("%w of %d bytes", errCorruptRecord, n)
+		}
+		var rec JournalRecord
+		if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&rec); err != nil {
+			return nil, n, err
+		}
+		return &rec, n, nil
+	}
+
+	line, err := r.ReadBytes('\n')
+	if err == io.EOF {
+		if len(line) > 0 {
+			// the record is being written, or was torn
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	n := len(line)
+	var size, sum uint32
+	var b []byte
+	if _, err := fmt.Sscanf(string(line), "%08x %08x ", &size, &sum); err == nil && len(line) > 18 {
+		b = line[18 : len(line)-1]
+	}
+	if b == nil || int(size) != len(b) || crc32.ChecksumIEEE(b) != sum {
+		return nil, n, fmt.Errorf("%w of %d bytes", errCorruptRecord, n)
+	}
+
+	var raw jsonRecord
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, n, err
+	}
+	args, err := j.decodeArgs(raw.Name, raw.Args)
+	if err != nil {
+		return nil, n, err
+	}
+	return &JournalRecord{Seq: raw.Seq, Time: raw.Time, Name: raw.Name, Args: args}, n, nil
+}
+
+// decode the arguments with the types set by SetArgTypes, as generic values without them.
+func (j *Journal) decodeArgs(name string, raws []json.RawMessage) ([]interface{}, error) {
+	j.mu.Lock()
+	types, typed := j.argTypes[name]
+	j.mu.Unlock()
+	if typed && len(types) != len(raws) {
+		return nil, fmt.Errorf("%s: Argument length expected %d, but got %d", name, len(types), len(raws))
+	}
+
+	args := make([]interface{}, 0, len(raws))
+	for i, raw := range raws {
+		if !typed {
+			var v interface{}
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, err
+			}
+			args = append(args, v)
+			continue
+		}
+		v := reflect.New(types[i])
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return nil, fmt.Errorf("%s: Args[%d]: %s", name, i, err)
+		}
+		args = append(args, v.Elem().Interface())
+	}
+	return args, nil
+}
+
+func (j *Journal) offsetsFile() string {
+	return j.filename + "-offsets.json"
+}
+
+func (j *Journal) loadOffsets() error {
+	b, err := os.ReadFile(j.offsetsFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &j.offsets)
+}
+
+// write the offsets to a temporary file then rename it, needs omu.
+func (j *Journal) saveOffsets() error {
+	b, err := json.Marshal(j.offsets)
+	if err != nil {
+		return err
+	}
+	tmp := j.offsetsFile() + ".tmp"
+	if err := os.WriteFile(tmp, b, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.offsetsFile())
+}
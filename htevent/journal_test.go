@@ -0,0 +1,116 @@
+package htevent
+
+import (
+	"context"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type journalOrder struct{ ID int }
+
+func init() {
+	gob.Register(journalOrder{})
+}
+
+// append n orders from first to the journal of fn and close it.
+func appendOrders(t *testing.T, fn string, format JournalFormat, first, n int) {
+	t.Helper()
+	j, err := OpenJournal(fn, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := first; i < first+n; i++ {
+		if err := j.Append("order", journalOrder{i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+}
+
+// replay the ids of the orders of the journal of fn.
+func replayOrders(t *testing.T, fn string, format JournalFormat) ([]int, *Journal) {
+	t.Helper()
+	j, err := OpenJournal(fn, format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.SetArgTypes("order", journalOrder{})
+	var ids []int
+	err = j.Replay(time.Time{}, func(ctx context.Context, name string, args ...interface{}) error {
+		ids = append(ids, args[0].(journalOrder).ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids, j
+}
+
+func journalFile(t *testing.T, fn string) string {
+	t.Helper()
+	files, err := filepath.Glob(fn + ".*")
+	if err != nil || len(files) != 1 {
+		t.Fatal(files, err)
+	}
+	return files[0]
+}
+
+func TestJournalTornTail(t *testing.T) {
+	for _, format := range []JournalFormat{JournalJSON, JournalGob} {
+		fn := filepath.Join(t.TempDir(), "events")
+		appendOrders(t, fn, format, 1, 3)
+
+		// a crash while writing the 4th record
+		name := journalFile(t, fn)
+		b, _ := os.ReadFile(name)
+		good := len(b)
+		appendOrders(t, fn, format, 4, 1)
+		b, _ = os.ReadFile(name)
+		if err := os.WriteFile(name, b[:good+(len(b)-good)/2], 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		appendOrders(t, fn, format, 5, 2)
+		ids, j := replayOrders(t, fn, format)
+		if len(ids) != 5 || ids[0] != 1 || ids[3] != 5 || ids[4] != 6 {
+			t.Fatalf("format %d: replayed %v", format, ids)
+		}
+		if j.seq != 5 {
+			t.Fatalf("format %d: seq %d", format, j.seq)
+		}
+		j.Close()
+	}
+}
+
+func TestJournalCorruptRecord(t *testing.T) {
+	for _, format := range []JournalFormat{JournalJSON, JournalGob} {
+		fn := filepath.Join(t.TempDir(), "events")
+		appendOrders(t, fn, format, 1, 1)
+		name := journalFile(t, fn)
+		b, _ := os.ReadFile(name)
+		first := len(b)
+		appendOrders(t, fn, format, 2, 2)
+
+		// flip a byte of the payload of the 2nd record
+		b, _ = os.ReadFile(name)
+		b[first+20] ^= 0xff
+		if err := os.WriteFile(name, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		ids, j := replayOrders(t, fn, format)
+		if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+			t.Fatalf("format %d: replayed %v", format, ids)
+		}
+		if err := j.Append("order", journalOrder{4}); err != nil {
+			t.Fatal(err)
+		}
+		j.Close()
+		if ids, _ = replayOrders(t, fn, format); len(ids) != 3 || ids[2] != 4 {
+			t.Fatalf("format %d: replayed %v", format, ids)
+		}
+	}
+}
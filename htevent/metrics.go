@@ -0,0 +1,310 @@
+package htevent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the delivery latency histograms.
+var LatencyBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// topicMetrics counts the activity of an event, updated atomically.
+type topicMetrics struct {
+	emits      uint64
+	deliveries uint64
+	errors     uint64
+	panics     uint64
+	buckets    []uint64 // per LatencyBuckets, not cumulative, plus +Inf
+	sumNanos   uint64
+}
+
+func newTopicMetrics() *topicMetrics {
+	return &topicMetrics{buckets: make([]uint64, len(LatencyBuckets)+1)}
+}
+
+func (m *topicMetrics) emit() {
+	if m != nil {
+		atomic.AddUint64(&m.emits, 1)
+	}
+}
+
+// record a listener call.
+func (m *topicMetrics) delivered(d time.Duration, err error) {
+	atomic.AddUint64(&m.deliveries, 1)
+	if err != nil && !errors.Is(err, ErrStopPropagation) {
+		var pe *PanicError
+		if errors.As(err, &pe) {
+			atomic.AddUint64(&m.panics, 1)
+		} else {
+			atomic.AddUint64(&m.errors, 1)
+		}
+	}
+	atomic.AddUint64(&m.sumNanos, uint64(d))
+	i := sort.SearchFloat64s(LatencyBuckets, d.Seconds())
+	atomic.AddUint64(&m.buckets[i], 1)
+}
+
+// measure wraps the calls, so their deliveries are recorded in m.
+func (m *topicMetrics) measure(calls []call) []call {
+	if m == nil {
+		return calls
+	}
+	measured := make([]call, len(calls))
+	for i, c := range calls {
+		fn := c.fn
+		c.fn = func(ctx context.Context) error {
+			start := time.Now()
+			err := protect(func() error {
+				return fn(ctx)
+			})
+			m.delivered(time.Since(start), err)
+			return err
+		}
+		measured[i] = c
+	}
+	return measured
+}
+
+// TopicMetrics is a snapshot of the metrics of an event, or of a wildcard subscription.
+type TopicMetrics struct {
+	Name       string
+	Listeners  int
+	Signature  []reflect.Type
+	Emits      uint64 // Handler calls, before the operators
+	Deliveries uint64 // listener calls
+	Errors     uint64 // listener calls returning an error
+	Panics     uint64 // listener calls panicking
+	Latency    Histogram
+}
+
+// Histogram is a latency histogram in seconds.
+type Histogram struct {
+	Buckets []float64 // upper bounds, LatencyBuckets
+	Counts  []uint64  // cumulative counts per bucket
+	Count   uint64
+	Sum     float64
+}
+
+// MetricsSnapshot is the state of a dispatcher, topics sorted by name.
+type MetricsSnapshot struct {
+	Time   time.Time
+	Topics []TopicMetrics
+}
+
+func (m *topicMetrics) snapshot(name string) TopicMetrics {
+	h := Histogram{
+		Buckets: LatencyBuckets,
+		Counts:  make([]uint64, len(LatencyBuckets)),
+		Sum:     time.Duration(atomic.LoadUint64(&m.sumNanos)).Seconds(),
+	}
+	var total uint64
+	for i := range m.buckets {
+		total += atomic.LoadUint64(&m.buckets[i])
+		if i < len(h.Counts) {
+			h.Counts[i] = total
+		}
+	}
+	h.Count = total
+
+	return TopicMetrics{
+		Name:       name,
+		Emits:      atomic.LoadUint64(&m.emits),
+		Deliveries: atomic.LoadUint64(&m.deliveries),
+		Errors:     atomic.LoadUint64(&m.errors),
+		Panics:     atomic.LoadUint64(&m.panics),
+		Latency:    h,
+	}
+}
+
+// WritePrometheus writes the snapshot in the Prometheus text exposition format.
+func (s *MetricsSnapshot) WritePrometheus(w io.Writer) error {
+	var b strings.Builder
+
+	counter := func(metric, help string, value func(t *TopicMetrics) uint64) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s counter\n", metric, help, metric)
+		for i := range s.Topics {
+			t := &s.Topics[i]
+			fmt.Fprintf(&b, "%s{topic=%s} %d\n", metric, promLabel(t.Name), value(t))
+		}
+	}
+	counter("htevent_emits_total", "Events emitted.", func(t *TopicMetrics) uint64 { return t.Emits })
+	counter("htevent_deliveries_total", "Listener calls.", func(t *TopicMetrics) uint64 { return t.Deliveries })
+	counter("htevent_errors_total", "Listener calls returning an error.", func(t *TopicMetrics) uint64 { return t.Errors })
+	counter("htevent_panics_total", "Listener calls panicking.", func(t *TopicMetrics) uint64 { return t.Panics })
+
+	b.WriteString("# HELP htevent_listeners Registered listeners.\n# TYPE htevent_listeners gauge\n")
+	for _, t := range s.Topics {
+		fmt.Fprintf(&b, "htevent_listeners{topic=%s} %d\n", promLabel(t.Name), t.Listeners)
+	}
+
+	b.WriteString("# HELP htevent_delivery_seconds Listener call latency.\n# TYPE htevent_delivery_seconds histogram\n")
+	for _, t := range s.Topics {
+		topic := promLabel(t.Name)
+		for i, le := range t.Latency.Buckets {
+			fmt.Fprintf(&b, "htevent_delivery_seconds_bucket{topic=%s,le=\"%s\"} %d\n", topic, promFloat(le), t.Latency.Counts[i])
+		}
+		fmt.Fprintf(&b, "htevent_delivery_seconds_bucket{topic=%s,le=\"+Inf\"} %d\n", topic, t.Latency.Count)
+		fmt.Fprintf(&b, "htevent_delivery_seconds_sum{topic=%s} %s\n", topic, promFloat(t.Latency.Sum))
+		fmt.Fprintf(&b, "htevent_delivery_seconds_count{topic=%s} %d\n", topic, t.Latency.Count)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func promLabel(v string) string {
+	return strconv.Quote(v)
+}
+
+func promFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// metricsRegistry holds the metrics of the dispatcher events by name.
+type metricsRegistry struct {
+	m  map[string]*topicMetrics
+	mu sync.Mutex
+}
+
+// return the metrics of name, nil if no event of name was registered.
+func (r *metricsRegistry) lookup(name string) *topicMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.m[name]
+}
+
+// remove the metrics of name, the event was destroyed.
+func (r *metricsRegistry) remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.m, name)
+}
+
+func (r *metricsRegistry) get(name string) *topicMetrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.m == nil {
+		r.m = map[string]*topicMetrics{}
+	}
+	m, ok := r.m[name]
+	if !ok {
+		m = newTopicMetrics()
+		r.m[name] = m
+	}
+	return m
+}
+
+// Events returns the names of the events and wildcard subscriptions, sorted.
+func (t *htDispatcher) Events() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := map[string]bool{}
+	t.each(func(name string, _ modeSetter) {
+		names[name] = true
+	})
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// ListenerCount returns the number of listeners of the event, typed ones included.
+func (t *htDispatcher) ListenerCount(name string) int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.listenerCount(name)
+}
+
+func (t *htDispatcher) listenerCount(name string) int {
+	n := 0
+	if ev, ok := t.event(name).(*event); ok {
+		n += ev.listenerCount()
+	}
+	if te, ok := t.topics[name]; ok {
+		n += te.listenerCount()
+	}
+	return n
+}
+
+// Signature returns the most general argument types of the listeners of the event,
+// without the leading context.Context.
+func (t *htDispatcher) Signature(name string) ([]reflect.Type, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.signature(name)
+}
+
+func (t *htDispatcher) signature(name string) ([]reflect.Type, error) {
+	if te, ok := t.topics[name]; ok {
+		return te.signature(), nil
+	}
+	if isPattern(name) {
+		return nil, fmt.Errorf("%s is a wildcard name, it has no signature", name)
+	}
+	ev, ok := t.events[name].(*event)
+	if !ok {
+		return nil, newHTEventNotDefined(name)
+	}
+	return ev.signature(), nil
+}
+
+// Metrics returns a snapshot of the metrics of every event.
+func (t *htDispatcher) Metrics() *MetricsSnapshot {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	snap := &MetricsSnapshot{Time: time.Now()}
+	t.metrics.mu.Lock()
+	names := make([]string, 0, len(t.metrics.m))
+	for name := range t.metrics.m {
+		names = append(names, name)
+	}
+	t.metrics.mu.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		tm := t.metrics.get(name).snapshot(name)
+		tm.Listeners = t.listenerCount(name)
+		tm.Signature, _ = t.signature(name)
+		snap.Topics = append(snap.Topics, tm)
+	}
+	return snap
+}
+
+func (p *event) listenerCount() int {
+	p.lmu.RLock()
+	defer p.lmu.RUnlock()
+	return len(p.listeners)
+}
+
+func (p *event) signature() []reflect.Type {
+	p.tmu.RLock()
+	defer p.tmu.RUnlock()
+	return append([]reflect.Type(nil), p.argTypes...)
+}
+
+func (p *Typed[T]) listenerCount() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.listeners)
+}
+
+func (p *Typed[T]) signature() []reflect.Type {
+	return []reflect.Type{reflect.TypeOf((*T)(nil)).Elem()}
+}
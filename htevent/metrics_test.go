@@ -0,0 +1,47 @@
+package htevent
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// find the metrics of the event name.
+func topicMetricsOf(t *testing.T, d HTDispatcher, name string) TopicMetrics {
+	t.Helper()
+	for _, m := range d.Metrics().Topics {
+		if m.Name == name {
+			return m
+		}
+	}
+	t.Fatalf("no metrics for %s", name)
+	return TopicMetrics{}
+}
+
+// a stop of the propagation, wrapped or not, isn't a failed delivery.
+func TestMetricsErrors(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+	results := []error{
+		ErrStopPropagation,
+		fmt.Errorf("no auth: %w", ErrStopPropagation),
+		errors.New("boom"),
+		nil,
+	}
+	for _, err := range results {
+		err := err
+		sub, _ := d.On("check", func() error { return err })
+		d.Handler("check")
+		sub.Unsubscribe()
+	}
+	d.On("crash", func() { panic("crash") })
+	d.Handler("crash")
+
+	m := topicMetricsOf(t, d, "check")
+	if m.Deliveries != 4 || m.Errors != 1 || m.Panics != 0 {
+		t.Fatalf("deliveries %d errors %d panics %d, want 4 1 0", m.Deliveries, m.Errors, m.Panics)
+	}
+	if m := topicMetricsOf(t, d, "crash"); m.Panics != 1 || m.Errors != 0 {
+		t.Fatalf("panics %d errors %d, want 1 0", m.Panics, m.Errors)
+	}
+}
@@ -0,0 +1,64 @@
+package htevent
+
+import "context"
+
+// HandlerFunc dispatches an event, the innermost one delivers it to the listeners.
+type HandlerFunc func(ctx context.Context, name string, args ...interface{}) error
+
+// Middleware wraps every dispatch of a dispatcher. It may change the context or
+// the arguments before calling next, or reject the event by returning an error
+// without calling it.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// chain builds the handler, the first middleware is the outermost one.
+func chain(middlewares []Middleware, h HandlerFunc) HandlerFunc {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
+
+type emissionKey struct{}
+
+// emission marks the dispatch made by EmitSticky or Request. It's set in the context passed to
+// the middlewares and dropped by HandlerContext and before the listeners are called,
+// so the emits made with the same context don't inherit it.
+type emission struct {
+	sticky  bool
+	request *pendingRequest
+}
+
+func withEmission(ctx context.Context, e *emission) context.Context {
+	return context.WithValue(ctx, emissionKey{}, e)
+}
+
+// return the emission of the dispatch, nil for a plain emit.
+func emissionOf(ctx context.Context) *emission {
+	e, _ := ctx.Value(emissionKey{}).(*emission)
+	return e
+}
+
+// drop the emission of ctx, if any.
+func clearEmission(ctx context.Context) context.Context {
+	if emissionOf(ctx) == nil {
+		return ctx
+	}
+	return withEmission(ctx, nil)
+}
+
+// emitter is a dispatcher whose dispatches keep the emission of the context,
+// for the scopes forwarding the sticky emits and the requests to it.
+type emitter interface {
+	emit(ctx context.Context, name string, args []interface{}) error
+}
+
+// return the handler dispatching to d, keeping the emission of the context if d can.
+func emitHandler(d HTDispatcher) HandlerFunc {
+	e, ok := d.(emitter)
+	if !ok {
+		return d.HandlerContext
+	}
+	return func(ctx context.Context, name string, args ...interface{}) error {
+		return e.emit(ctx, name, args)
+	}
+}
@@ -0,0 +1,353 @@
+package htevent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DispatchMode decides how an event delivers to its listeners.
+type DispatchMode int
+
+const (
+	// ModeConcurrent calls every listener in its own goroutine and waits for all of them.
+	ModeConcurrent DispatchMode = iota
+	// ModeSync calls the listeners one by one in registration order.
+	ModeSync
+	// ModeAsync calls every listener in its own goroutine and returns at once.
+	ModeAsync
+	// ModePool queues the calls to a bounded worker pool and returns at once.
+	// The emitter blocks while the queue is full.
+	ModePool
+)
+
+const defaultQueueSize = 1024
+
+func (m DispatchMode) String() string {
+	switch m {
+	case ModeConcurrent:
+		return "concurrent"
+	case ModeSync:
+		return "sync"
+	case ModeAsync:
+		return "async"
+	case ModePool:
+		return "pool"
+	}
+	return "unknown"
+}
+
+// workerPool runs queued calls on a fixed number of goroutines.
+type workerPool struct {
+	tasks   chan func()
+	wg      sync.WaitGroup
+	once    sync.Once
+	submits sync.WaitGroup // submits blocked on a full queue
+	closing bool
+	mu      sync.Mutex
+}
+
+func newWorkerPool(workers, queueSize int) *workerPool {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if queueSize < 0 {
+		queueSize = defaultQueueSize
+	}
+
+	p := &workerPool{tasks: make(chan func(), queueSize)}
+	p.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer p.wg.Done()
+			for f := range p.tasks {
+				f()
+			}
+		}()
+	}
+	return p
+}
+
+// queue f, false if the pool is closing.
+func (p *workerPool) submit(f func()) bool {
+	p.mu.Lock()
+	if p.closing {
+		p.mu.Unlock()
+		return false
+	}
+	p.submits.Add(1)
+	p.mu.Unlock()
+
+	defer p.submits.Done()
+	p.tasks <- f
+	return true
+}
+
+// close stops the workers after the queued calls are done.
+func (p *workerPool) close() {
+	p.mu.Lock()
+	p.closing = true
+	p.mu.Unlock()
+
+	p.once.Do(func() {
+		// the workers keep draining the queue, so the blocked submits finish
+		p.submits.Wait()
+		close(p.tasks)
+	})
+	p.wg.Wait()
+}
+
+// modeSetter is implemented by event and Typed through dispatch.
+type modeSetter interface {
+	setMode(mode DispatchMode)
+	setPool(pool *workerPool, own bool)
+	setErrorHandler(f func(err error))
+	setMetrics(m *topicMetrics)
+	close()
+}
+
+// dispatch delivers calls according to the mode, shared by event and Typed.
+type dispatch struct {
+	mode    DispatchMode
+	pool    *workerPool
+	ownPool bool
+	closed  bool
+	pending sync.WaitGroup // async and pool calls not finished yet
+	onError atomic.Pointer[func(err error)]
+	metrics *topicMetrics
+	mu      sync.RWMutex
+}
+
+func (d *dispatch) setMode(mode DispatchMode) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mode = mode
+}
+
+// use a pool of workers goroutines and a queue of queueSize calls,
+// replacing the pool in use.
+func (d *dispatch) setWorkerPool(workers, queueSize int) {
+	d.setPool(newWorkerPool(workers, queueSize), true)
+}
+
+func (d *dispatch) setPool(pool *workerPool, own bool) {
+	d.mu.Lock()
+	old, oldOwn := d.pool, d.ownPool
+	d.pool, d.ownPool = pool, own
+	d.mu.Unlock()
+
+	if old != nil && oldOwn {
+		go old.close()
+	}
+}
+
+func (d *dispatch) setErrorHandler(f func(err error)) {
+	if f == nil {
+		d.onError.Store(nil)
+		return
+	}
+	d.onError.Store(&f)
+}
+
+func (d *dispatch) setMetrics(m *topicMetrics) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.metrics = m
+}
+
+// count an emit in the metrics.
+func (d *dispatch) emitted() {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	d.metrics.emit()
+}
+
+// report the failure of an async call, nobody waits for it.
+// It doesn't take d.mu, pool workers call it while an emit may wait for them.
+func (d *dispatch) report(err error) {
+	f := d.onError.Load()
+	if f == nil {
+		fmt.Fprintf(os.Stderr, "htevent: %s\n", err)
+		return
+	}
+	(*f)(err)
+}
+
+// call f, a panic is returned as *PanicError.
+func protect(f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return f()
+}
+
+// call is one listener call of a delivery.
+type call struct {
+	fn       func(ctx context.Context) error
+	timeout  time.Duration // per listener timeout, 0 means none
+	priority int
+}
+
+// invoke the call and wait for it until ctx is done, the listener keeps
+// running in background after that but its result is dropped.
+func (c call) invoke(ctx context.Context) error {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	f := func() error {
+		return c.fn(ctx)
+	}
+	if ctx.Done() == nil {
+		return protect(f)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- protect(f)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run the listener calls, the errors of the calls it waits for are returned
+// as ListenerErrors, the others are reported to the error handler.
+// Listeners still running when ctx is done fail with ctx.Err().
+func (d *dispatch) run(ctx context.Context, calls []call) error {
+	return d.exec(ctx, calls, true)
+}
+
+// measure the calls in the metrics of d, for the calls run by another dispatch.
+func (d *dispatch) measure(calls []call) []call {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.metrics.measure(calls)
+}
+
+// run the calls in the mode of d, measured in its metrics unless they already are.
+func (d *dispatch) exec(ctx context.Context, calls []call, measure bool) error {
+	d.mu.RLock()
+	for d.mode == ModePool && d.pool == nil && !d.closed {
+		// the pool is created before measuring, so the calls are measured once
+		d.mu.RUnlock()
+		d.mu.Lock()
+		if d.mode == ModePool && d.pool == nil && !d.closed {
+			d.pool, d.ownPool = newWorkerPool(0, -1), true
+		}
+		d.mu.Unlock()
+		d.mu.RLock()
+	}
+	if d.closed {
+		d.mu.RUnlock()
+		return ErrEventClosed
+	}
+	if measure {
+		calls = d.metrics.measure(calls)
+	}
+
+	switch d.mode {
+	case ModeSync:
+		d.mu.RUnlock()
+		ctx, prop := withPropagation(ctx)
+		var errs ListenerErrors
+		for i, c := range calls {
+			stop, err := prop.stop(c.invoke(ctx))
+			if err != nil {
+				errs = append(errs, &ListenerError{Index: i, Err: err})
+			}
+			if stop {
+				break
+			}
+		}
+		return errs.orNil()
+
+	case ModeAsync:
+		d.pending.Add(len(calls))
+		d.mu.RUnlock()
+		for i, c := range calls {
+			go func(i int, c call) {
+				defer d.pending.Done()
+				if err := ignoreStop(c.invoke(ctx)); err != nil {
+					d.report(&ListenerError{Index: i, Err: err})
+				}
+			}(i, c)
+		}
+
+	case ModePool:
+		// counted under the lock, so close waits for them, but queued without it:
+		// a full queue must not block close and the workers reporting errors
+		pool := d.pool
+		d.pending.Add(len(calls))
+		d.mu.RUnlock()
+		for i, c := range calls {
+			i, c := i, c
+			f := func() {
+				defer d.pending.Done()
+				if err := ignoreStop(c.invoke(ctx)); err != nil {
+					d.report(&ListenerError{Index: i, Err: err})
+				}
+			}
+			if !pool.submit(f) {
+				// the pool was replaced and is closing
+				go f()
+			}
+		}
+
+	default:
+		d.mu.RUnlock()
+		results := make([]error, len(calls))
+		wg := sync.WaitGroup{}
+		wg.Add(len(calls))
+		for i, c := range calls {
+			go func(i int, c call) {
+				defer wg.Done()
+				results[i] = ignoreStop(c.invoke(ctx))
+			}(i, c)
+		}
+		wg.Wait()
+
+		var errs ListenerErrors
+		for i, err := range results {
+			if err != nil {
+				errs = append(errs, &ListenerError{Index: i, Err: err})
+			}
+		}
+		return errs.orNil()
+	}
+	return nil
+}
+
+func (d *dispatch) isClosed() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.closed
+}
+
+// close rejects new calls and waits for the pending ones.
+func (d *dispatch) close() {
+	d.mu.Lock()
+	d.closed = true
+	pool, own := d.pool, d.ownPool
+	d.mu.Unlock()
+
+	d.pending.Wait()
+	if pool != nil && own {
+		pool.close()
+	}
+}
@@ -0,0 +1,100 @@
+package htevent
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Close must return while emits are blocked on a full pool queue and the
+// workers report listener errors.
+func TestCloseSaturatedPool(t *testing.T) {
+	ev := New()
+	ev.SetMode(ModePool)
+	ev.SetWorkerPool(1, 1)
+	var reported atomic.Int32
+	ev.SetErrorHandler(func(err error) {
+		reported.Add(1)
+	})
+	ev.On(func(i int) error {
+		time.Sleep(time.Millisecond)
+		return errors.New("failed")
+	})
+
+	emitted := make(chan struct{})
+	go func() {
+		defer close(emitted)
+		for i := 0; i < 20; i++ {
+			if err := ev.Handler(i); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		ev.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close blocked on the saturated pool")
+	}
+	<-emitted
+	if reported.Load() == 0 {
+		t.Fatal("no error reported")
+	}
+}
+
+// replacing the pool while an emit is blocked on the old queue must not lose calls.
+func TestReplacePoolWhileQueueing(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModePool)
+	d.SetWorkerPool(1, 1)
+	var calls atomic.Int32
+	d.On("tick", func(i int) {
+		time.Sleep(time.Millisecond)
+		calls.Add(1)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			d.Handler("tick", i)
+		}
+	}()
+	time.Sleep(3 * time.Millisecond)
+	d.SetWorkerPool(2, 1)
+	<-done
+	d.Close()
+	if n := calls.Load(); n != 20 {
+		t.Fatalf("got %d calls, want 20", n)
+	}
+}
+
+// a delivery in ModePool is measured once, with the pool created by the first emit.
+func TestPoolMetrics(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModePool)
+	d.On("job", func(i int) {})
+	if err := d.Handler("job", 1); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	for _, m := range d.Metrics().Topics {
+		if m.Name != "job" {
+			continue
+		}
+		if m.Emits != 1 || m.Deliveries != 1 || m.Latency.Count != 1 {
+			t.Fatalf("emits %d deliveries %d latency count %d, want 1 1 1",
+				m.Emits, m.Deliveries, m.Latency.Count)
+		}
+		return
+	}
+	t.Fatal("no metrics for job")
+}
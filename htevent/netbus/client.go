@@ -0,0 +1,354 @@
+package netbus
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
+)
+
+const (
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+	ackTimeout        = 5 * time.Second
+)
+
+// Client connects a dispatcher to a server. It reconnects when the connection
+// is lost and subscribes its topics again.
+type Client struct {
+	codecs
+
+	d       htevent.HTDispatcher
+	network string
+	addr    string
+
+	p       *peer // nil while disconnected
+	topics  map[string]bool
+	forward map[string]bool // the topic patterns of the local emits sent to the server
+	acks    map[string][]chan struct{}
+	closed  bool
+	mu      sync.Mutex
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	onError func(err error)
+}
+
+// Dial connects to the server at addr, the events received are dispatched on d.
+func Dial(network, addr string, d htevent.HTDispatcher) (*Client, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		d:       d,
+		network: network,
+		addr:    addr,
+		p:       newPeer(conn),
+		topics:  map[string]bool{},
+		forward: map[string]bool{},
+		acks:    map[string][]chan struct{}{},
+		done:    make(chan struct{}),
+	}
+	d.Use(c.middleware)
+	c.wg.Add(1)
+	go c.loop(c.p)
+	return c, nil
+}
+
+// SetErrorHandler receives the errors of the events received from the server,
+// they are printed to stderr by default.
+func (c *Client) SetErrorHandler(f func(err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.onError = f
+}
+
+func (c *Client) error(err error) {
+	c.mu.Lock()
+	f := c.onError
+	c.mu.Unlock()
+	if f == nil {
+		f = printError
+	}
+	f(err)
+}
+
+// Subscribe receives the events matching the topic patterns, wildcards included.
+// It returns when the server has registered them. While disconnected it fails,
+// but the topics are kept and subscribed on reconnect.
+func (c *Client) Subscribe(patterns ...string) error {
+	for _, pattern := range patterns {
+		c.mu.Lock()
+		c.topics[pattern] = true
+		c.mu.Unlock()
+
+		if err := c.request(opSubscribe, pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Unsubscribe stops receiving the events of the topic patterns.
+func (c *Client) Unsubscribe(patterns ...string) error {
+	for _, pattern := range patterns {
+		c.mu.Lock()
+		delete(c.topics, pattern)
+		c.mu.Unlock()
+
+		if err := c.request(opUnsubscribe, pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Forward sends the events dispatched on the local dispatcher matching the topic
+// patterns to the server, like Publish. The events received from the server and
+// the requests aren't sent.
+func (c *Client) Forward(patterns ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pattern := range patterns {
+		c.forward[pattern] = true
+	}
+}
+
+// StopForward stops sending the local events of the topic patterns.
+func (c *Client) StopForward(patterns ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, pattern := range patterns {
+		delete(c.forward, pattern)
+	}
+}
+
+func (c *Client) forwarded(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for pattern := range c.forward {
+		if htevent.MatchTopic(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// middleware sends the forwarded local dispatches to the server. The local listeners
+// are called first, a forwarding error goes to the error handler.
+func (c *Client) middleware(next htevent.HandlerFunc) htevent.HandlerFunc {
+	return func(ctx context.Context, name string, args ...interface{}) error {
+		if htevent.IsRequest(ctx) || origin(ctx) != nil || !c.forwarded(name) {
+			return next(ctx, name, args...)
+		}
+		err := next(ctx, name, args...)
+		if _, ferr := c.send(name, args); ferr != nil {
+			c.error(ferr)
+		} else if isNotDefined(err) {
+			return nil
+		}
+		return err
+	}
+}
+
+// send a sub or unsub and wait for the ack.
+func (c *Client) request(op, pattern string) error {
+	ack := make(chan struct{})
+	c.mu.Lock()
+	p := c.p
+	if p == nil {
+		c.mu.Unlock()
+		return fmt.Errorf("Not connected to %s", c.addr)
+	}
+	c.acks[pattern] = append(c.acks[pattern], ack)
+	c.mu.Unlock()
+
+	if err := p.send(&frame{Op: op, Name: pattern}); err != nil {
+		c.dropAck(pattern, ack)
+		return err
+	}
+
+	select {
+	case <-ack:
+		return nil
+	case <-c.done:
+		return fmt.Errorf("Client closed")
+	case <-time.After(ackTimeout):
+		c.dropAck(pattern, ack)
+		return fmt.Errorf("Subscription %s not acknowledged", pattern)
+	}
+}
+
+func (c *Client) dropAck(pattern string, ack chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiting := c.acks[pattern]
+	for i, w := range waiting {
+		if w == ack {
+			c.acks[pattern] = append(waiting[:i], waiting[i+1:]...)
+			break
+		}
+	}
+	if len(c.acks[pattern]) == 0 {
+		delete(c.acks, pattern)
+	}
+}
+
+// wake the first waiter of pattern.
+func (c *Client) acked(pattern string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiting := c.acks[pattern]
+	if len(waiting) == 0 {
+		return
+	}
+	close(waiting[0])
+	if len(waiting) == 1 {
+		delete(c.acks, pattern)
+	} else {
+		c.acks[pattern] = waiting[1:]
+	}
+}
+
+// Publish sends the event to the server, and dispatches it on the local dispatcher.
+func (c *Client) Publish(name string, args ...interface{}) error {
+	return c.PublishContext(context.Background(), name, args...)
+}
+
+// PublishContext is Publish, ctx is passed to the local listeners.
+func (c *Client) PublishContext(ctx context.Context, name string, args ...interface{}) error {
+	p, err := c.send(name, args)
+	if err != nil {
+		return err
+	}
+
+	// already sent, the middleware doesn't forward it again
+	err = c.d.HandlerContext(withOrigin(ctx, p), name, args...)
+	if isNotDefined(err) {
+		return nil
+	}
+	return err
+}
+
+// send the event to the server, return the connection it was sent on.
+func (c *Client) send(name string, args []interface{}) (*peer, error) {
+	f, err := encode(&c.codecs, name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	p := c.p
+	c.mu.Unlock()
+	if p == nil {
+		return nil, fmt.Errorf("Not connected to %s", c.addr)
+	}
+	return p, p.send(f)
+}
+
+// read the server frames, reconnect when the connection is lost.
+func (c *Client) loop(p *peer) {
+	defer c.wg.Done()
+	for p != nil {
+		c.read(p)
+		p.conn.Close()
+
+		c.mu.Lock()
+		c.p = nil
+		c.mu.Unlock()
+
+		p = c.reconnect()
+	}
+}
+
+func (c *Client) read(p *peer) {
+	for {
+		f, err := p.recv()
+		if err != nil {
+			return
+		}
+
+		switch f.Op {
+		case opAck:
+			c.acked(f.Name)
+		case opPublish:
+			if err := dispatch(withOrigin(context.Background(), p), c.d, &c.codecs, f); err != nil {
+				c.error(err)
+			}
+		default:
+			c.error(fmt.Errorf("Unknown operation %q", f.Op))
+		}
+	}
+}
+
+// dial until it succeeds or the client is closed, then subscribe the topics again.
+func (c *Client) reconnect() *peer {
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(delay):
+		}
+
+		conn, err := net.Dial(c.network, c.addr)
+		if err != nil {
+			delay *= 2
+			if delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+
+		p := newPeer(conn)
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		topics := make([]string, 0, len(c.topics))
+		for pattern := range c.topics {
+			topics = append(topics, pattern)
+		}
+		c.p = p
+		c.mu.Unlock()
+
+		for _, pattern := range topics {
+			if err := p.send(&frame{Op: opSubscribe, Name: pattern}); err != nil {
+				break
+			}
+		}
+		return p
+	}
+}
+
+// Connected reports whether the client is connected to the server.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.p != nil
+}
+
+// Close disconnects from the server and stops reconnecting.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	if c.p != nil {
+		c.p.conn.Close()
+	}
+	c.mu.Unlock()
+
+	c.wg.Wait()
+	return nil
+}
@@ -0,0 +1,131 @@
+package netbus
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Codec serializes the arguments of an event.
+type Codec interface {
+	Encode(args []interface{}) ([]byte, error)
+	Decode(data []byte) ([]interface{}, error)
+}
+
+// JSON returns a codec decoding the arguments as values of the samples' types,
+// so the listeners get the types they were registered with.
+// Without samples the arguments are decoded as generic JSON values
+// (float64, string, map[string]interface{} ...).
+func JSON(samples ...interface{}) Codec {
+	return &jsonCodec{types: sampleTypes(samples)}
+}
+
+// Gob returns a codec for arguments of the samples' types, gob needs them to decode.
+func Gob(samples ...interface{}) Codec {
+	return &gobCodec{types: sampleTypes(samples)}
+}
+
+func sampleTypes(samples []interface{}) []reflect.Type {
+	types := make([]reflect.Type, 0, len(samples))
+	for _, s := range samples {
+		types = append(types, reflect.TypeOf(s))
+	}
+	return types
+}
+
+type jsonCodec struct {
+	types []reflect.Type
+}
+
+func (c *jsonCodec) Encode(args []interface{}) ([]byte, error) {
+	return json.Marshal(args)
+}
+
+func (c *jsonCodec) Decode(data []byte) ([]interface{}, error) {
+	if len(c.types) == 0 {
+		var args []interface{}
+		err := json.Unmarshal(data, &args)
+		return args, err
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, err
+	}
+	if len(raws) != len(c.types) {
+		return nil, fmt.Errorf("Argument length expected %d, but got %d", len(c.types), len(raws))
+	}
+
+	args := make([]interface{}, 0, len(raws))
+	for i, raw := range raws {
+		v := reflect.New(c.types[i])
+		if err := json.Unmarshal(raw, v.Interface()); err != nil {
+			return nil, fmt.Errorf("Args[%d]: %s", i, err)
+		}
+		args = append(args, v.Elem().Interface())
+	}
+	return args, nil
+}
+
+type gobCodec struct {
+	types []reflect.Type
+}
+
+func (c *gobCodec) Encode(args []interface{}) ([]byte, error) {
+	if len(args) != len(c.types) {
+		return nil, fmt.Errorf("Argument length expected %d, but got %d", len(c.types), len(args))
+	}
+
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for i, a := range args {
+		if err := enc.Encode(a); err != nil {
+			return nil, fmt.Errorf("Args[%d]: %s", i, err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (c *gobCodec) Decode(data []byte) ([]interface{}, error) {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	args := make([]interface{}, 0, len(c.types))
+	for i, t := range c.types {
+		v := reflect.New(t)
+		if err := dec.Decode(v.Interface()); err != nil {
+			return nil, fmt.Errorf("Args[%d]: %s", i, err)
+		}
+		args = append(args, v.Elem().Interface())
+	}
+	return args, nil
+}
+
+// codecs holds the codecs registered per event name, shared by Server and Client.
+type codecs struct {
+	m  map[string]Codec
+	mu sync.RWMutex
+}
+
+// RegisterCodec sets the codec of an event, both sides have to register the same one.
+// Events without a codec use JSON without samples.
+func (c *codecs) RegisterCodec(name string, codec Codec) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = map[string]Codec{}
+	}
+	c.m[name] = codec
+}
+
+func (c *codecs) codec(name string) Codec {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if codec, ok := c.m[name]; ok {
+		return codec
+	}
+	return defaultCodec
+}
+
+var defaultCodec = JSON()
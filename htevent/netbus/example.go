@@ -0,0 +1,76 @@
+package netbus
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
+)
+
+type order struct {
+	ID    int
+	Price float64
+}
+
+func Netbus_test() {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	serverSide := htevent.NewHTDispatcher()
+	server := NewServer(serverSide)
+	server.RegisterCodec("order.created", JSON(order{}))
+	go server.Serve(l)
+	defer server.Close()
+
+	clientSide := htevent.NewHTDispatcher()
+	client, err := Dial("tcp", l.Addr().String(), clientSide)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer client.Close()
+	client.RegisterCodec("order.created", JSON(order{}))
+	client.RegisterCodec("greeting", Gob("", 0))
+
+	client.RegisterCodec("order.paid", JSON(order{}))
+
+	received := make(chan string, 3)
+	clientSide.On("order.created", func(o order) {
+		received <- fmt.Sprintf("client got order %d: %.2f", o.ID, o.Price)
+	})
+	// Subscribe returns once the server has registered the topic
+	if err := client.Subscribe("order.*"); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	serverSide.On("greeting", func(s string, n int) {
+		received <- fmt.Sprintf("server got %s %d", s, n)
+	})
+	serverSide.On("order.paid", func(o order) {
+		received <- fmt.Sprintf("server got paid order %d", o.ID)
+	})
+	server.RegisterCodec("greeting", Gob("", 0))
+	server.RegisterCodec("order.paid", JSON(order{}))
+
+	serverSide.Handler("order.created", order{ID: 1, Price: 9.5})
+	client.Publish("greeting", "hello", 1)
+
+	// the local emits of order.paid are sent to the server too
+	client.Forward("order.paid")
+	clientSide.Handler("order.paid", order{ID: 1, Price: 9.5})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case s := <-received:
+			fmt.Println(s)
+		case <-time.After(time.Second):
+			fmt.Println("timeout")
+			return
+		}
+	}
+}
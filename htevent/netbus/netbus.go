@@ -0,0 +1,108 @@
+// Package netbus connects htevent dispatchers of different processes
+// over TCP or unix sockets.
+//
+// A Server exposes a dispatcher, every event dispatched on it is sent to the
+// clients subscribed to a matching topic. A Client emits the events it receives
+// on its own dispatcher, and Publish sends events to the server, which
+// dispatches them to its listeners and to the other clients. Forward sends
+// the matching events of the client dispatcher the same way.
+package netbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
+)
+
+const (
+	opSubscribe   = "sub"
+	opUnsubscribe = "unsub"
+	opPublish     = "pub"
+	opAck         = "ack" // the server handled a sub or unsub
+)
+
+// frame is a message on the wire, one JSON object per line.
+type frame struct {
+	Op      string `json:"op"`
+	Name    string `json:"name"` // the topic pattern of sub and unsub, the event name of pub
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// peer is one end of a connection, writes are serialized.
+type peer struct {
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+	wmu  sync.Mutex
+}
+
+func newPeer(conn net.Conn) *peer {
+	return &peer{
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+		dec:  json.NewDecoder(conn),
+	}
+}
+
+func (p *peer) send(f *frame) error {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+	return p.enc.Encode(f)
+}
+
+func (p *peer) recv() (*frame, error) {
+	var f frame
+	if err := p.dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+type originKey struct{}
+
+// withOrigin marks the events received from p, so they aren't sent back to it.
+func withOrigin(ctx context.Context, p *peer) context.Context {
+	return context.WithValue(ctx, originKey{}, p)
+}
+
+func origin(ctx context.Context) *peer {
+	p, _ := ctx.Value(originKey{}).(*peer)
+	return p
+}
+
+// encode the arguments of the event name with its codec.
+func encode(c *codecs, name string, args []interface{}) (*frame, error) {
+	payload, err := c.codec(name).Encode(args)
+	if err != nil {
+		return nil, fmt.Errorf("Encode %s: %s", name, err)
+	}
+	return &frame{Op: opPublish, Name: name, Payload: payload}, nil
+}
+
+// dispatch a received event on d, an event without listeners isn't an error.
+func dispatch(ctx context.Context, d htevent.HTDispatcher, c *codecs, f *frame) error {
+	args, err := c.codec(f.Name).Decode(f.Payload)
+	if err != nil {
+		return fmt.Errorf("Decode %s: %s", f.Name, err)
+	}
+	err = d.HandlerContext(ctx, f.Name, args...)
+	if isNotDefined(err) {
+		return nil
+	}
+	return err
+}
+
+func isNotDefined(err error) bool {
+	var nd *htevent.HTEventNotDefined
+	return errors.As(err, &nd)
+}
+
+func printError(err error) {
+	fmt.Fprintf(os.Stderr, "netbus: %s\n", err)
+}
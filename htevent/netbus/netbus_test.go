@@ -0,0 +1,283 @@
+package netbus
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
+)
+
+type item struct {
+	ID   int
+	Name string
+}
+
+// start a server of d on a localhost port.
+func startServer(t *testing.T, d htevent.HTDispatcher, addr string) *Server {
+	t.Helper()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(d)
+	s.SetErrorHandler(func(err error) {})
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func dial(t *testing.T, s *Server) (*Client, htevent.HTDispatcher) {
+	t.Helper()
+	s.mu.Lock()
+	var addr string
+	for l := range s.listeners {
+		addr = l.Addr().String()
+	}
+	s.mu.Unlock()
+	d := htevent.NewHTDispatcher()
+	c, err := Dial("tcp", addr, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c, d
+}
+
+// wait for the listeners to start.
+func waitServer(t *testing.T, s *Server) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		n := len(s.listeners)
+		s.mu.Unlock()
+		if n > 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server not listening")
+}
+
+// wait for a value of ch.
+func receive[T any](t *testing.T, ch chan T) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing received")
+	}
+	var zero T
+	return zero
+}
+
+func TestRoundTrip(t *testing.T) {
+	serverSide := htevent.NewHTDispatcher()
+	s := startServer(t, serverSide, "127.0.0.1:0")
+	waitServer(t, s)
+	s.RegisterCodec("item.json", JSON(item{}))
+	s.RegisterCodec("item.gob", Gob(item{}, 0))
+
+	c, clientSide := dial(t, s)
+	c.RegisterCodec("item.json", JSON(item{}))
+	c.RegisterCodec("item.gob", Gob(item{}, 0))
+
+	fromServer := make(chan item, 1)
+	clientSide.On("item.json", func(it item) { fromServer <- it })
+	if err := c.Subscribe("item.*"); err != nil {
+		t.Fatal(err)
+	}
+	serverSide.Handler("item.json", item{ID: 1, Name: "json"})
+	if got := receive(t, fromServer); got != (item{ID: 1, Name: "json"}) {
+		t.Fatalf("json: got %+v", got)
+	}
+
+	type gobArgs struct {
+		it item
+		n  int
+	}
+	fromClient := make(chan gobArgs, 1)
+	serverSide.On("item.gob", func(it item, n int) { fromClient <- gobArgs{it, n} })
+	if err := c.Publish("item.gob", item{ID: 2, Name: "gob"}, 7); err != nil {
+		t.Fatal(err)
+	}
+	if got := receive(t, fromClient); got.it != (item{ID: 2, Name: "gob"}) || got.n != 7 {
+		t.Fatalf("gob: got %+v", got)
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	serverSide := htevent.NewHTDispatcher()
+	s := startServer(t, serverSide, "127.0.0.1:0")
+	waitServer(t, s)
+	c, clientSide := dial(t, s)
+
+	got := make(chan string, 10)
+	clientSide.On("a", func(v string) { got <- "a " + v })
+	clientSide.On("b", func(v string) { got <- "b " + v })
+	if err := c.Subscribe("a", "b"); err != nil {
+		t.Fatal(err)
+	}
+	serverSide.Handler("a", "1")
+	if v := receive(t, got); v != "a 1" {
+		t.Fatalf("got %s", v)
+	}
+
+	if err := c.Unsubscribe("a"); err != nil {
+		t.Fatal(err)
+	}
+	serverSide.Handler("a", "2")
+	serverSide.Handler("b", "3")
+	// the frames of a connection arrive in order
+	if v := receive(t, got); v != "b 3" {
+		t.Fatalf("got %s after Unsubscribe, want b 3", v)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	serverSide := htevent.NewHTDispatcher()
+	s := startServer(t, serverSide, "127.0.0.1:0")
+	waitServer(t, s)
+	c, clientSide := dial(t, s)
+	addr := c.addr
+
+	got := make(chan float64, 10)
+	clientSide.On("tick", func(v float64) { got <- v })
+	if err := c.Subscribe("tick"); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	serverSide = htevent.NewHTDispatcher()
+	s = startServer(t, serverSide, addr)
+	waitServer(t, s)
+
+	// the client subscribes again once reconnected
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		serverSide.Handler("tick", 1)
+		select {
+		case v := <-got:
+			if v != 1 {
+				t.Fatalf("got %v", v)
+			}
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("not reconnected")
+		}
+	}
+}
+
+// a client not reading doesn't block the emits and is disconnected.
+func TestSlowClient(t *testing.T) {
+	serverSide := htevent.NewHTDispatcher()
+	s := startServer(t, serverSide, "127.0.0.1:0")
+	waitServer(t, s)
+	var mu sync.Mutex
+	var errs []error
+	s.SetErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+
+	s.mu.Lock()
+	var addr string
+	for l := range s.listeners {
+		addr = l.Addr().String()
+	}
+	s.mu.Unlock()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	json.NewEncoder(conn).Encode(&frame{Op: opSubscribe, Name: "big"})
+	// wait for the ack, then stop reading
+	var ack frame
+	if err := json.NewDecoder(conn).Decode(&ack); err != nil || ack.Op != opAck {
+		t.Fatalf("no ack: %+v %v", ack, err)
+	}
+
+	payload := strings.Repeat("x", 64<<10)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2*sendQueueSize; i++ {
+			serverSide.Handler("big", payload)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("emits blocked by a slow client")
+	}
+
+	for i := 0; ; i++ {
+		s.mu.Lock()
+		n := len(s.clients)
+		s.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		if i == 500 {
+			t.Fatal("slow client not disconnected")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) == 0 || !strings.Contains(errs[0].Error(), "too slow") {
+		t.Fatalf("errors: %v", errs)
+	}
+}
+
+// the forwarded local emits reach the server and the other clients, never back to
+// the sender, and the received events aren't forwarded again.
+func TestForward(t *testing.T) {
+	serverSide := htevent.NewHTDispatcher()
+	s := startServer(t, serverSide, "127.0.0.1:0")
+	waitServer(t, s)
+	a, sideA := dial(t, s)
+	b, sideB := dial(t, s)
+
+	got := make(chan string, 10)
+	serverSide.On("note.x", func(v string) { got <- "server " + v })
+	sideA.On("note.x", func(v string) { got <- "a " + v })
+	sideB.On("note.x", func(v string) { got <- "b " + v })
+	for _, c := range []*Client{a, b} {
+		c.Forward("note.*")
+		if err := c.Subscribe("note.*"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := sideA.Handler("note.x", "1"); err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]int{}
+	for i := 0; i < 3; i++ {
+		seen[receive(t, got)]++
+	}
+	if seen["a 1"] != 1 || seen["server 1"] != 1 || seen["b 1"] != 1 {
+		t.Fatalf("got %v", seen)
+	}
+
+	// nothing else arrives: no echo to a, no forward back by b
+	a.StopForward("note.*")
+	sideA.Handler("note.x", "2")
+	if v := receive(t, got); v != "a 2" {
+		t.Fatalf("got %s, want a 2", v)
+	}
+	select {
+	case v := <-got:
+		t.Fatalf("got %s", v)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,278 @@
+package netbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
+)
+
+// Server exposes a dispatcher to the clients.
+type Server struct {
+	codecs
+
+	d         htevent.HTDispatcher
+	listeners map[net.Listener]bool
+	clients   map[*client]bool
+	closed    bool
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+
+	onError func(err error)
+}
+
+const (
+	sendQueueSize = 256             // frames waiting for a client
+	writeTimeout  = 5 * time.Second // a client not reading for it is disconnected
+)
+
+// client is a connected client and its subscriptions. The frames are sent
+// from its queue by a writer, a full queue disconnects the client.
+type client struct {
+	*peer
+	topics map[string]bool
+	mu     sync.RWMutex
+
+	queue chan *frame
+	done  chan struct{} // closed when the client is dropped
+}
+
+// queue f, return false if the queue is full.
+func (c *client) enqueue(f *frame) bool {
+	select {
+	case c.queue <- f:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *client) subscribed(name string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for pattern := range c.topics {
+		if htevent.MatchTopic(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewServer creates a server of d, the events dispatched on d are sent
+// to the subscribed clients from now on.
+func NewServer(d htevent.HTDispatcher) *Server {
+	s := &Server{
+		d:         d,
+		listeners: map[net.Listener]bool{},
+		clients:   map[*client]bool{},
+	}
+	d.Use(s.middleware)
+	return s
+}
+
+// SetErrorHandler receives the errors of the connections and of the events
+// published by the clients, they are printed to stderr by default.
+func (s *Server) SetErrorHandler(f func(err error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onError = f
+}
+
+func (s *Server) error(err error) {
+	s.mu.Lock()
+	f := s.onError
+	s.mu.Unlock()
+	if f == nil {
+		f = printError
+	}
+	f(err)
+}
+
+// ListenAndServe listens on network ("tcp", "unix" ...) and addr, then calls Serve.
+func (s *Server) ListenAndServe(network, addr string) error {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts the clients of l until the server is closed.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return fmt.Errorf("Server closed")
+	}
+	s.listeners[l] = true
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+
+		c := &client{
+			peer:   newPeer(conn),
+			topics: map[string]bool{},
+			queue:  make(chan *frame, sendQueueSize),
+			done:   make(chan struct{}),
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.clients[c] = true
+		s.wg.Add(2)
+		s.mu.Unlock()
+
+		go s.serve(c)
+		go s.write(c)
+	}
+}
+
+// read the frames of c until it disconnects.
+func (s *Server) serve(c *client) {
+	defer s.wg.Done()
+	defer s.drop(c)
+
+	for {
+		f, err := c.recv()
+		if err != nil {
+			return
+		}
+
+		switch f.Op {
+		case opSubscribe:
+			c.mu.Lock()
+			c.topics[f.Name] = true
+			c.mu.Unlock()
+			s.queue(c, &frame{Op: opAck, Name: f.Name})
+		case opUnsubscribe:
+			c.mu.Lock()
+			delete(c.topics, f.Name)
+			c.mu.Unlock()
+			s.queue(c, &frame{Op: opAck, Name: f.Name})
+		case opPublish:
+			if err := dispatch(withOrigin(context.Background(), c.peer), s.d, &s.codecs, f); err != nil {
+				s.error(err)
+			}
+		default:
+			s.error(fmt.Errorf("Unknown operation %q", f.Op))
+		}
+	}
+}
+
+// send the queued frames of c until it's dropped.
+func (s *Server) write(c *client) {
+	defer s.wg.Done()
+	for {
+		select {
+		case f := <-c.queue:
+			c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.send(f); err != nil {
+				// the reader drops it
+				c.conn.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// queue f for c, a client too slow to empty its queue is disconnected.
+func (s *Server) queue(c *client, f *frame) bool {
+	if c.enqueue(f) {
+		return true
+	}
+	s.error(fmt.Errorf("Client %s too slow, disconnected", c.conn.RemoteAddr()))
+	c.conn.Close()
+	return false
+}
+
+func (s *Server) drop(c *client) {
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+	c.conn.Close()
+	close(c.done)
+}
+
+// middleware sends every dispatch of the server dispatcher to the subscribed clients,
+// except the client it came from. Requests stay local.
+func (s *Server) middleware(next htevent.HandlerFunc) htevent.HandlerFunc {
+	return func(ctx context.Context, name string, args ...interface{}) error {
+		if htevent.IsRequest(ctx) {
+			return next(ctx, name, args...)
+		}
+		err := next(ctx, name, args...)
+		sent, berr := s.broadcast(origin(ctx), name, args)
+		if berr != nil {
+			return berr
+		}
+		if sent && isNotDefined(err) {
+			return nil
+		}
+		return err
+	}
+}
+
+// queue the event for the subscribed clients, sent is true if there was one.
+// It doesn't wait for the clients to read it.
+func (s *Server) broadcast(from *peer, name string, args []interface{}) (sent bool, err error) {
+	s.mu.Lock()
+	targets := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		if c.peer != from && c.subscribed(name) {
+			targets = append(targets, c)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(targets) == 0 {
+		return false, nil
+	}
+
+	f, err := encode(&s.codecs, name, args)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range targets {
+		if s.queue(c, f) {
+			sent = true
+		}
+	}
+	return sent, nil
+}
+
+// Close stops listening and disconnects the clients.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
@@ -0,0 +1,181 @@
+package htevent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type operatorKind int
+
+const (
+	opDebounce operatorKind = iota
+	opThrottle
+	opCoalesce
+)
+
+// MergeFunc merges the arguments of an event into the pending ones, for Coalesce.
+type MergeFunc func(pending, args []interface{}) []interface{}
+
+// operator reshapes the deliveries of an event.
+type operator struct {
+	kind    operatorKind
+	d       time.Duration
+	merge   MergeFunc
+	clock   Clock
+	deliver func(ctx context.Context, args []interface{}) error
+	report  func(err error)
+
+	timer   Timer
+	gen     uint64 // generation of timer, a stale one doesn't deliver
+	pending []interface{}
+	ctx     context.Context
+	last    time.Time // last delivery of a throttle
+	mu      sync.Mutex
+}
+
+func (o *operator) emit(ctx context.Context, args []interface{}) error {
+	// the delivery may be later, ctx values are kept but not its cancellation
+	ctx = context.WithoutCancel(ctx)
+
+	o.mu.Lock()
+	switch o.kind {
+	case opDebounce:
+		o.pending, o.ctx = args, ctx
+		if o.timer != nil {
+			o.timer.Stop()
+		}
+		o.arm(o.d)
+
+	case opThrottle:
+		now := o.clock.Now()
+		if o.timer == nil && (o.last.IsZero() || now.Sub(o.last) >= o.d) {
+			o.last = now
+			o.mu.Unlock()
+			return o.deliver(ctx, args)
+		}
+		// the latest one is delivered at the end of the interval
+		o.pending, o.ctx = args, ctx
+		if o.timer == nil {
+			o.arm(o.last.Add(o.d).Sub(now))
+		}
+
+	case opCoalesce:
+		if o.timer == nil {
+			o.pending, o.ctx = args, ctx
+			o.arm(o.d)
+		} else if o.merge != nil {
+			o.pending = o.merge(o.pending, args)
+		} else {
+			o.pending, o.ctx = args, ctx
+		}
+	}
+	o.mu.Unlock()
+	return nil
+}
+
+// start the timer of a new generation, o.mu is held.
+func (o *operator) arm(d time.Duration) {
+	o.gen++
+	gen := o.gen
+	o.timer = o.clock.AfterFunc(d, func() {
+		o.fire(gen)
+	})
+}
+
+// deliver the pending arguments. The timer of gen may have been replaced or
+// stopped while it was starting, then it's stale and does nothing.
+func (o *operator) fire(gen uint64) {
+	o.mu.Lock()
+	if gen != o.gen {
+		o.mu.Unlock()
+		return
+	}
+	args, ctx := o.pending, o.ctx
+	o.pending, o.ctx, o.timer = nil, nil, nil
+	if o.kind == opThrottle {
+		o.last = o.clock.Now()
+	}
+	o.mu.Unlock()
+
+	if ctx == nil {
+		return
+	}
+	if err := o.deliver(ctx, args); err != nil {
+		o.report(err)
+	}
+}
+
+// stop drops the pending delivery.
+func (o *operator) stop() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.timer != nil {
+		o.timer.Stop()
+	}
+	o.gen++
+	o.pending, o.ctx, o.timer = nil, nil, nil
+}
+
+// Debounce delivers an event only after d without another one, with the latest arguments.
+func (t *htDispatcher) Debounce(name string, d time.Duration) error {
+	return t.setOperator(name, &operator{kind: opDebounce, d: d})
+}
+
+// Throttle delivers an event at most once every interval. The first one is delivered
+// at once, the latest of the following ones at the end of the interval.
+func (t *htDispatcher) Throttle(name string, interval time.Duration) error {
+	return t.setOperator(name, &operator{kind: opThrottle, d: interval})
+}
+
+// Coalesce delivers the events emitted within window after the first one as one,
+// merging their arguments with merge. A nil merge keeps the latest arguments.
+func (t *htDispatcher) Coalesce(name string, window time.Duration, merge MergeFunc) error {
+	return t.setOperator(name, &operator{kind: opCoalesce, d: window, merge: merge})
+}
+
+// ClearOperator removes the operator of the event, its pending delivery is dropped.
+func (t *htDispatcher) ClearOperator(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	op, ok := t.operators[name]
+	if !ok {
+		return newHTEventNotDefined(name)
+	}
+	op.stop()
+	delete(t.operators, name)
+	return nil
+}
+
+// SetClock sets the clock of the operators set after it.
+func (t *htDispatcher) SetClock(c Clock) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clock = c
+	return nil
+}
+
+func (t *htDispatcher) setOperator(name string, op *operator) error {
+	if isPattern(name) {
+		return fmt.Errorf("%s is a wildcard name, operators apply to concrete events", name)
+	}
+	if op.d <= 0 {
+		return fmt.Errorf("Duration should be positive, but got %s", op.d)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	op.clock = t.clock
+	op.deliver = func(ctx context.Context, args []interface{}) error {
+		return t.deliverNow(ctx, name, args...)
+	}
+	op.report = func(err error) {
+		t.report(name, err)
+	}
+	if old, ok := t.operators[name]; ok {
+		old.stop()
+	}
+	t.operators[name] = op
+	return nil
+}
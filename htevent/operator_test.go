@@ -0,0 +1,130 @@
+package htevent
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// start of the manual clocks of the tests.
+var testStart = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// return a dispatcher on a manual clock and the values delivered to "v".
+func operatorDispatcher(t *testing.T) (HTDispatcher, *ManualClock, *[]int) {
+	t.Helper()
+	clock := NewManualClock(testStart)
+	d := NewHTDispatcher()
+	d.SetClock(clock)
+	got := &[]int{}
+	if _, err := d.On("v", func(i int) { *got = append(*got, i) }); err != nil {
+		t.Fatal(err)
+	}
+	return d, clock, got
+}
+
+func checkDelivered(t *testing.T, got *[]int, want ...int) {
+	t.Helper()
+	if len(*got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Fatalf("got %v, want %v", *got, want)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	d, clock, got := operatorDispatcher(t)
+	d.Debounce("v", time.Second)
+
+	d.Handler("v", 1)
+	clock.Advance(500 * time.Millisecond)
+	d.Handler("v", 2)
+	clock.Advance(900 * time.Millisecond)
+	checkDelivered(t, got)
+	clock.Advance(100 * time.Millisecond)
+	checkDelivered(t, got, 2)
+
+	d.Handler("v", 3)
+	d.ClearOperator("v")
+	clock.Advance(time.Second)
+	checkDelivered(t, got, 2)
+}
+
+// stopClock is a ManualClock whose timers can't be stopped, like
+// a time.Timer already started when Stop is called.
+type stopClock struct {
+	*ManualClock
+}
+
+type unstoppable struct{}
+
+func (unstoppable) Stop() bool {
+	return false
+}
+
+func (c stopClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.ManualClock.AfterFunc(d, f)
+	return unstoppable{}
+}
+
+// a replaced debounce timer firing anyway doesn't deliver early.
+func TestDebounceStaleTimer(t *testing.T) {
+	clock := NewManualClock(testStart)
+	d := NewHTDispatcher()
+	d.SetClock(stopClock{clock})
+	var got []int
+	d.On("v", func(i int) { got = append(got, i) })
+	d.Debounce("v", time.Second)
+
+	d.Handler("v", 1)
+	clock.Advance(500 * time.Millisecond)
+	d.Handler("v", 2)
+	clock.Advance(600 * time.Millisecond)
+	checkDelivered(t, &got)
+	clock.Advance(400 * time.Millisecond)
+	checkDelivered(t, &got, 2)
+}
+
+func TestThrottle(t *testing.T) {
+	d, clock, got := operatorDispatcher(t)
+	d.Throttle("v", time.Second)
+
+	d.Handler("v", 1)
+	checkDelivered(t, got, 1)
+	d.Handler("v", 2)
+	clock.Advance(300 * time.Millisecond)
+	d.Handler("v", 3)
+	checkDelivered(t, got, 1)
+	clock.Advance(700 * time.Millisecond)
+	checkDelivered(t, got, 1, 3)
+
+	// an interval after the last delivery, at once again
+	clock.Advance(time.Second)
+	d.Handler("v", 4)
+	checkDelivered(t, got, 1, 3, 4)
+}
+
+func TestCoalesce(t *testing.T) {
+	clock := NewManualClock(testStart)
+	d := NewHTDispatcher()
+	d.SetClock(clock)
+	var got [][]int
+	d.On("batch", func(ids []int) { got = append(got, ids) })
+	d.Coalesce("batch", time.Second, func(pending, args []interface{}) []interface{} {
+		return []interface{}{append(pending[0].([]int), args[0].([]int)...)}
+	})
+
+	d.Handler("batch", []int{1})
+	clock.Advance(500 * time.Millisecond)
+	d.Handler("batch", []int{2, 3})
+	clock.Advance(499 * time.Millisecond)
+	if len(got) != 0 {
+		t.Fatalf("delivered before the window: %v", got)
+	}
+	clock.Advance(time.Millisecond)
+	d.Handler("batch", []int{4})
+	clock.Advance(time.Second)
+	if want := [][]int{{1, 2, 3}, {4}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
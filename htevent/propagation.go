@@ -0,0 +1,48 @@
+package htevent
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+type propagationKey struct{}
+
+// propagation is put into the context of a ModeSync delivery.
+type propagation struct {
+	stopped int32
+}
+
+// StopPropagation stops the delivery to the listeners of lower priority,
+// ctx is the context received by the listener. It works in ModeSync only,
+// in the other modes all listeners are started together.
+func StopPropagation(ctx context.Context) {
+	if p, ok := ctx.Value(propagationKey{}).(*propagation); ok {
+		atomic.StoreInt32(&p.stopped, 1)
+	}
+}
+
+func withPropagation(ctx context.Context) (context.Context, *propagation) {
+	p := &propagation{}
+	return context.WithValue(ctx, propagationKey{}, p), p
+}
+
+// whether the listener with err, or StopPropagation, stopped the delivery.
+// The bare ErrStopPropagation is dropped from err.
+func (p *propagation) stop(err error) (bool, error) {
+	if err == ErrStopPropagation {
+		return true, nil
+	}
+	if err != nil && errors.Is(err, ErrStopPropagation) {
+		return true, err
+	}
+	return atomic.LoadInt32(&p.stopped) == 1, err
+}
+
+// outside ModeSync the bare ErrStopPropagation is ignored.
+func ignoreStop(err error) error {
+	if err == ErrStopPropagation {
+		return nil
+	}
+	return err
+}
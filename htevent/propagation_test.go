@@ -0,0 +1,56 @@
+package htevent
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// the priorities and ErrStopPropagation apply across the wildcard,
+// reflective and typed listeners of one delivery.
+func TestPriorityAcrossListeners(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+
+	var mu sync.Mutex
+	var got []string
+	record := func(s string) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, s)
+	}
+
+	allowed := false
+	d.OnPriority("order.#", 100, func(name string, id string) error {
+		record("auth")
+		if !allowed {
+			return ErrStopPropagation
+		}
+		return nil
+	})
+	d.OnPriority("order.created", 50, func(id string) {
+		record("audit")
+	})
+	topic, err := NewTopic[string](d, "order.created")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topic.On(func(id string) {
+		record("business")
+	})
+
+	if err := topic.Emit("o1"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"auth"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	got, allowed = nil, true
+	if err := d.Handler("order.created", "o2"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"auth", "audit", "business"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,337 @@
+package htevent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// RequestMode decides which responders a request calls.
+// Responders are the listeners returning values besides a trailing error.
+type RequestMode int
+
+const (
+	// RequestSingle requires exactly one responder and returns its results.
+	RequestSingle RequestMode = iota
+	// RequestFirst calls the responders concurrently and returns the results
+	// of the first one succeeding, the others' contexts are cancelled.
+	RequestFirst
+	// RequestAll calls every responder and waits for them, each result is
+	// the []interface{} of one responder, in delivery order.
+	RequestAll
+)
+
+func (m RequestMode) String() string {
+	switch m {
+	case RequestSingle:
+		return "single"
+	case RequestFirst:
+		return "first"
+	case RequestAll:
+		return "all"
+	}
+	return "unknown"
+}
+
+func (p *event) SetRequestMode(mode RequestMode) {
+	p.tmu.Lock()
+	defer p.tmu.Unlock()
+	p.requestMode = mode
+}
+
+func (p *event) Request(ctx context.Context, args ...interface{}) ([]interface{}, error) {
+	if p.isClosed() {
+		return nil, ErrEventClosed
+	}
+	if err := p.validate(args); err != nil {
+		return nil, err
+	}
+
+	p.tmu.RLock()
+	mode := p.requestMode
+	p.tmu.RUnlock()
+
+	responders := p.responders(args)
+	if mode == RequestSingle && len(responders) != 1 {
+		return nil, fmt.Errorf("Request expected 1 responder, but got %d", len(responders))
+	}
+	return callResponders(ctx, mode, p.requestCalls(responders, args))
+}
+
+// return the responders taking args.
+func (p *event) responders(args []interface{}) []*listener {
+	argTypes := make([]reflect.Type, 0, len(args))
+	for _, v := range args {
+		argTypes = append(argTypes, reflect.TypeOf(v))
+	}
+
+	p.lmu.RLock()
+	defer p.lmu.RUnlock()
+	var responders []*listener
+	for _, l := range p.listeners {
+		if len(fnResultTypes(l.fn)) == 0 || !fits(l.fn.Type(), argTypes) {
+			continue
+		}
+		responders = append(responders, l)
+	}
+	return responders
+}
+
+// return the calls of the responders with args, measured in the metrics of the event.
+// The Once and OnN responders reaching their count are removed.
+func (p *event) requestCalls(responders []*listener, args []interface{}) []*requestCall {
+	arguments := make([]reflect.Value, 0, len(args))
+	for _, v := range args {
+		arguments = append(arguments, reflect.ValueOf(v))
+	}
+
+	var done []uint64
+	calls := make([]*requestCall, 0, len(responders))
+	for _, l := range responders {
+		ok, last := l.take()
+		if !ok {
+			continue
+		}
+		if last {
+			done = append(done, l.id)
+		}
+		c := &requestCall{l: l, arguments: arguments}
+		c.measured = p.measure([]call{{fn: c.call, timeout: l.timeout}})[0]
+		calls = append(calls, c)
+	}
+	for _, id := range done {
+		p.remove(id)
+	}
+	return calls
+}
+
+// call the responders according to mode.
+func callResponders(ctx context.Context, mode RequestMode, calls []*requestCall) ([]interface{}, error) {
+	if len(calls) == 0 {
+		return nil, fmt.Errorf("Request has no responder")
+	}
+	switch mode {
+	case RequestFirst:
+		return requestFirst(ctx, calls)
+	case RequestAll:
+		return requestAll(ctx, calls)
+	}
+	if err := calls[0].invoke(ctx); err != nil {
+		return nil, ListenerErrors{{Index: 0, Err: err}}
+	}
+	return calls[0].results, nil
+}
+
+// requestCall is the call of one responder, results are set when it succeeds.
+type requestCall struct {
+	l         *listener
+	arguments []reflect.Value
+	measured  call
+	results   []interface{}
+}
+
+func (c *requestCall) invoke(ctx context.Context) error {
+	return c.measured.invoke(ctx)
+}
+
+func (c *requestCall) call(ctx context.Context) error {
+	out := c.l.fn.Call(c.l.in(ctx, c.arguments))
+	if err := callErr(out); err != nil {
+		return err
+	}
+
+	n := len(fnResultTypes(c.l.fn))
+	results := make([]interface{}, 0, n)
+	for _, v := range out[:n] {
+		results = append(results, v.Interface())
+	}
+	c.results = results
+	return nil
+}
+
+func requestFirst(ctx context.Context, calls []*requestCall) ([]interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type reply struct {
+		i   int
+		err error
+	}
+	replies := make(chan reply, len(calls))
+	for i, c := range calls {
+		go func(i int, c *requestCall) {
+			replies <- reply{i, c.invoke(ctx)}
+		}(i, c)
+	}
+
+	var errs ListenerErrors
+	for range calls {
+		r := <-replies
+		if r.err == nil {
+			return calls[r.i].results, nil
+		}
+		errs = append(errs, &ListenerError{Index: r.i, Err: r.err})
+	}
+	return nil, errs
+}
+
+func requestAll(ctx context.Context, calls []*requestCall) ([]interface{}, error) {
+	errs := make([]error, len(calls))
+	wg := sync.WaitGroup{}
+	wg.Add(len(calls))
+	for i, c := range calls {
+		go func(i int, c *requestCall) {
+			defer wg.Done()
+			errs[i] = c.invoke(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	results := make([]interface{}, 0, len(calls))
+	var lerrs ListenerErrors
+	for i, err := range errs {
+		if err != nil {
+			lerrs = append(lerrs, &ListenerError{Index: i, Err: err})
+			continue
+		}
+		results = append(results, calls[i].results)
+	}
+	return results, lerrs.orNil()
+}
+
+// return result types, without the trailing error.
+func fnResultTypes(fn reflect.Value) []reflect.Type {
+	fnType := fn.Type()
+	n := fnType.NumOut()
+	if n > 0 && fnType.Out(n-1) == errorType {
+		n--
+	}
+
+	types := make([]reflect.Type, 0, n)
+	for i := 0; i < n; i++ {
+		types = append(types, fnType.Out(i))
+	}
+	return types
+}
+
+// if result size or type are different from the other responders return error,
+// listeners without results aren't responders and always pass.
+func (p *event) validateResults(types []reflect.Type) error {
+	if len(types) == 0 {
+		return nil
+	}
+
+	p.tmu.Lock()
+	defer p.tmu.Unlock()
+	if len(p.resultTypes) == 0 {
+		p.resultTypes = types
+		return nil
+	}
+	if len(types) != len(p.resultTypes) {
+		return fmt.Errorf("Result length expected %d, but got %d", len(p.resultTypes), len(types))
+	}
+	for i, t := range types {
+		if t != p.resultTypes[i] {
+			return fmt.Errorf("Result Error. Results[%d] expected %s, but got %s", i, p.resultTypes[i], t)
+		}
+	}
+	return nil
+}
+
+// pendingRequest carries the results of a request through the middlewares.
+type pendingRequest struct {
+	results []interface{}
+}
+
+// IsRequest reports whether the dispatch is a Request, for the middlewares:
+// the listeners called are the responders and their results are returned to the caller.
+// The emits made with the context of a request aren't requests.
+func IsRequest(ctx context.Context) bool {
+	e := emissionOf(ctx)
+	return e != nil && e.request != nil
+}
+
+// Request goes through the middlewares and the metrics like HandlerContext,
+// ctx is marked by IsRequest. Operators don't apply to requests.
+func (t *htDispatcher) Request(ctx context.Context, name string, args ...interface{}) ([]interface{}, error) {
+	t.mu.RLock()
+	err := t.checkDeclared(name)
+	t.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	return request(ctx, t.emit, name, args)
+}
+
+// make a request through the emit of a dispatcher.
+func request(ctx context.Context, emit func(ctx context.Context, name string, args []interface{}) error,
+	name string, args []interface{}) ([]interface{}, error) {
+	req := &pendingRequest{}
+	err := emit(withEmission(ctx, &emission{request: req}), name, args)
+	return req.results, err
+}
+
+// call the responders of name, at the end of the middlewares. The responders are
+// the reflective and wildcard listeners returning values, typed listeners return nothing.
+// Wildcard responders receive the event name first, the request mode is the one of the event.
+func (t *htDispatcher) respond(ctx context.Context, name string, args ...interface{}) ([]interface{}, error) {
+	t.mu.RLock()
+	ev, ok := t.events[name].(*event)
+	matched := t.patterns.match(name)
+	closed := t.closed
+	t.mu.RUnlock()
+
+	if closed {
+		return nil, ErrEventClosed
+	}
+	if !ok && len(matched) == 0 {
+		return nil, newHTEventNotDefined(name)
+	}
+
+	mode := RequestSingle
+	type source struct {
+		ev         *event
+		args       []interface{}
+		responders []*listener
+	}
+	var sources []source
+	n := 0
+	if ok {
+		if err := ev.validate(args); err != nil {
+			return nil, err
+		}
+		ev.tmu.RLock()
+		mode = ev.requestMode
+		ev.tmu.RUnlock()
+		r := ev.responders(args)
+		sources, n = append(sources, source{ev, args, r}), len(r)
+	}
+	named := append([]interface{}{name}, args...)
+	for _, pe := range matched {
+		pe.emitted()
+		r := pe.responders(named)
+		sources, n = append(sources, source{pe, named, r}), n+len(r)
+	}
+	if mode == RequestSingle && n != 1 {
+		return nil, fmt.Errorf("Request expected 1 responder, but got %d", n)
+	}
+
+	var calls []*requestCall
+	for _, src := range sources {
+		calls = append(calls, src.ev.requestCalls(src.responders, src.args)...)
+	}
+	return callResponders(ctx, mode, calls)
+}
+
+func (t *htDispatcher) SetRequestMode(name string, mode RequestMode) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	ev, ok := t.events[name]
+	if !ok {
+		return newHTEventNotDefined(name)
+	}
+	ev.SetRequestMode(mode)
+	return nil
+}
@@ -0,0 +1,129 @@
+package htevent
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Request goes through the middlewares and the metrics, marked by IsRequest.
+func TestRequestMiddleware(t *testing.T) {
+	d := NewHTDispatcher()
+	var seen []bool
+	d.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, name string, args ...interface{}) error {
+			seen = append(seen, IsRequest(ctx))
+			return next(ctx, name, args...)
+		}
+	})
+	d.On("audit", func(id int) {})
+	d.On("user.get", func(ctx context.Context, id int) (string, error) {
+		// the emits of a responder aren't requests
+		return "bob", d.HandlerContext(ctx, "audit", id)
+	})
+
+	results, err := d.Request(context.Background(), "user.get", 1)
+	if err != nil || len(results) != 1 || results[0] != "bob" {
+		t.Fatalf("got %v %v", results, err)
+	}
+	if len(seen) != 2 || !seen[0] || seen[1] {
+		t.Fatalf("IsRequest seen %v, want [true false]", seen)
+	}
+
+	emits := map[string]uint64{}
+	for _, m := range d.Metrics().Topics {
+		emits[m.Name] = m.Emits
+	}
+	if emits["user.get"] != 1 {
+		t.Fatalf("user.get emits %d, want 1", emits["user.get"])
+	}
+}
+
+// a middleware rejects a request like an emit, scope middlewares included.
+func TestRequestRejected(t *testing.T) {
+	denied := errors.New("denied")
+	d := NewHTDispatcher()
+	d.On("user.get", func(id int) string { return "bob" })
+	s := d.Scope()
+	defer s.Close()
+	s.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, name string, args ...interface{}) error {
+			if IsRequest(ctx) {
+				return denied
+			}
+			return next(ctx, name, args...)
+		}
+	})
+
+	if _, err := s.Request(context.Background(), "user.get", 1); !errors.Is(err, denied) {
+		t.Fatalf("got %v, want the middleware error", err)
+	}
+	if results, err := d.Request(context.Background(), "user.get", 1); err != nil || results[0] != "bob" {
+		t.Fatalf("got %v %v", results, err)
+	}
+}
+
+// an emit made by a middleware with the context of a request isn't a request.
+func TestRequestNotInherited(t *testing.T) {
+	d := NewHTDispatcher()
+	var audited []bool
+	d.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, name string, args ...interface{}) error {
+			if name == "user.get" {
+				if err := d.HandlerContext(ctx, "audit", name); err != nil {
+					return err
+				}
+			}
+			return next(ctx, name, args...)
+		}
+	})
+	d.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, name string, args ...interface{}) error {
+			if name == "audit" {
+				audited = append(audited, IsRequest(ctx))
+			}
+			return next(ctx, name, args...)
+		}
+	})
+	d.On("audit", func(name string) {})
+	d.On("user.get", func(id int) string { return "bob" })
+
+	if _, err := d.Request(context.Background(), "user.get", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(audited) != 1 || audited[0] {
+		t.Fatalf("audit IsRequest %v, want [false]", audited)
+	}
+}
+
+// responders are measured, wildcard responders answer too.
+func TestRequestResponders(t *testing.T) {
+	d := NewHTDispatcher()
+	d.On("user.get", func(id int) string { return "bob" })
+	d.On("user.*", func(name string, id int) string { return "cached " + name })
+	if err := d.SetRequestMode("user.get", RequestAll); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := d.Request(context.Background(), "user.get", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].([]interface{})[0] != "bob" ||
+		results[1].([]interface{})[0] != "cached user.get" {
+		t.Fatalf("got %v", results)
+	}
+
+	deliveries := map[string]uint64{}
+	for _, m := range d.Metrics().Topics {
+		deliveries[m.Name] = m.Latency.Count
+	}
+	if deliveries["user.get"] != 1 || deliveries["user.*"] != 1 {
+		t.Fatalf("measured %v, want one delivery each", deliveries)
+	}
+
+	// only a wildcard responder
+	if _, err := d.Request(context.Background(), "user.del", 1); err != nil {
+		t.Fatal(err)
+	}
+}
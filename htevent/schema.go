@@ -0,0 +1,177 @@
+package htevent
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Declare fixes the argument types of an event, instead of the listener types.
+// Listeners must take them and emits must be assignable to them.
+// Declaring an event again with the same types does nothing.
+func (t *htDispatcher) Declare(name string, argTypes ...reflect.Type) error {
+	if isPattern(name) {
+		return fmt.Errorf("%s is a wildcard name, only concrete events can be declared", name)
+	}
+	for i, at := range argTypes {
+		if at == nil {
+			return fmt.Errorf("Declared Args[%d] of %s is nil", i, name)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if old, ok := t.declared[name]; ok {
+		if !reflect.DeepEqual(old, argTypes) {
+			return fmt.Errorf("%s is already declared as %v", name, old)
+		}
+		return nil
+	}
+	if te, ok := t.topics[name]; ok {
+		if sig := te.signature(); !reflect.DeepEqual(sig, argTypes) {
+			return fmt.Errorf("%s topic is already typed as %v", name, sig)
+		}
+	}
+
+	ev, ok := t.events[name]
+	if !ok {
+		ev = New()
+		t.inherit(name, ev.(modeSetter))
+		t.events[name] = ev
+	}
+	if err := ev.(*event).declare(argTypes); err != nil {
+		return err
+	}
+	t.declared[name] = argTypes
+	return nil
+}
+
+// Declare declares the event name of d with an argument of type T, like NewTopic[T].
+func Declare[T any](d HTDispatcher, name string) error {
+	return d.Declare(name, reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// SetStrict rejects the emits and subscriptions of the events not declared.
+// Wildcard subscriptions are still allowed.
+func (t *htDispatcher) SetStrict(strict bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.strict = strict
+	return nil
+}
+
+// return an error if name must be declared and isn't, needs t.mu.
+func (t *htDispatcher) checkDeclared(name string) error {
+	if !t.strict || isPattern(name) {
+		return nil
+	}
+	if _, ok := t.declared[name]; !ok {
+		return newHTEventNotDeclared(name)
+	}
+	return nil
+}
+
+// lock the declared types, the listeners must take them.
+func (p *event) declare(types []reflect.Type) error {
+	p.lmu.RLock()
+	defer p.lmu.RUnlock()
+	for _, l := range p.listeners {
+		if !fits(l.fn.Type(), types) {
+			return fmt.Errorf("Listener %s can't take the declared arguments %v", funcName(l.fn), types)
+		}
+	}
+
+	p.tmu.Lock()
+	defer p.tmu.Unlock()
+	p.argTypes = types
+	p.variadic = false
+	p.declared = true
+	return nil
+}
+
+// TopicDoc documents an event of a dispatcher.
+type TopicDoc struct {
+	Name      string
+	Declared  bool
+	Signature []reflect.Type // nil for wildcard subscriptions
+	Listeners []string       // function names of the listeners
+}
+
+// Docs returns the documentation of every event and wildcard subscription, sorted by name.
+func (t *htDispatcher) Docs() []TopicDoc {
+	names := t.Events()
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	docs := make([]TopicDoc, 0, len(names))
+	for _, name := range names {
+		doc := TopicDoc{Name: name}
+		_, doc.Declared = t.declared[name]
+		doc.Signature, _ = t.signature(name)
+		if ev, ok := t.event(name).(*event); ok {
+			doc.Listeners = append(doc.Listeners, ev.listenerNames()...)
+		}
+		if te, ok := t.topics[name]; ok {
+			doc.Listeners = append(doc.Listeners, te.listenerNames()...)
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// WriteDocs writes the documentation of the events as text, like:
+//
+//	order.created(main.Order) declared
+//		main.(*Mailer).OnOrder-fm
+func (t *htDispatcher) WriteDocs(w io.Writer) error {
+	var b strings.Builder
+	for _, doc := range t.Docs() {
+		b.WriteString(doc.Name)
+		if doc.Signature != nil {
+			sig := make([]string, 0, len(doc.Signature))
+			for _, at := range doc.Signature {
+				sig = append(sig, at.String())
+			}
+			fmt.Fprintf(&b, "(%s)", strings.Join(sig, ", "))
+		}
+		if doc.Declared {
+			b.WriteString(" declared")
+		}
+		b.WriteString("\n")
+		for _, l := range doc.Listeners {
+			fmt.Fprintf(&b, "\t%s\n", l)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (p *event) listenerNames() []string {
+	p.lmu.RLock()
+	defer p.lmu.RUnlock()
+	names := make([]string, 0, len(p.listeners))
+	for _, l := range p.listeners {
+		names = append(names, funcName(l.fn))
+	}
+	return names
+}
+
+func (p *Typed[T]) listenerNames() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, 0, len(p.listeners))
+	for _, l := range p.listeners {
+		names = append(names, funcName(reflect.ValueOf(l.f)))
+	}
+	return names
+}
+
+func funcName(fn reflect.Value) string {
+	if f := runtime.FuncForPC(fn.Pointer()); f != nil {
+		return f.Name()
+	}
+	return fn.Type().String()
+}
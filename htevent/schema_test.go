@@ -0,0 +1,101 @@
+package htevent
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type schemaOrder struct{ ID int }
+
+func (o *schemaOrder) onCreated(schemaOrder) {}
+
+// the declared types win over the listener types.
+func TestDeclaredSignature(t *testing.T) {
+	d := NewHTDispatcher()
+	if err := Declare[error](d, "failed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Declare[error](d, "failed"); err != nil {
+		t.Fatalf("declaring again with the same type: %v", err)
+	}
+	if err := d.Declare("failed", reflect.TypeOf("")); err == nil {
+		t.Fatal("declared again with another type")
+	}
+
+	// a narrower listener can't take every declared argument
+	if _, err := d.On("failed", func(*argErr) {}); err == nil {
+		t.Fatal("func(*argErr) was registered on a declared error")
+	}
+	if _, err := d.On("failed", func(error) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Handler("failed", &argErr{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Handler("failed", 1); err == nil {
+		t.Fatal("an int was emitted to a declared error")
+	}
+
+	// a listener registered before must take the declared types
+	d.On("count", func(int) {})
+	if err := d.Declare("count", reflect.TypeOf("")); err == nil {
+		t.Fatal("declared a type the listener can't take")
+	}
+	if err := d.Declare("order.*", reflect.TypeOf(0)); err == nil {
+		t.Fatal("declared a wildcard name")
+	}
+}
+
+// a strict dispatcher rejects the events not declared, but not the wildcard subscriptions.
+func TestStrictDispatcher(t *testing.T) {
+	d := NewHTDispatcher()
+	Declare[int](d, "count")
+	d.SetStrict(true)
+
+	var nd *HTEventNotDeclared
+	if _, err := d.On("other", func(int) {}); !errors.As(err, &nd) || nd.HTEventName() != "other" {
+		t.Fatalf("On: got %v, want HTEventNotDeclared", err)
+	}
+	if err := d.Handler("other", 1); !errors.As(err, &nd) {
+		t.Fatalf("Handler: got %v, want HTEventNotDeclared", err)
+	}
+	if _, err := d.On("#", func(string, ...interface{}) {}); err != nil {
+		t.Fatalf("wildcard: %v", err)
+	}
+	if _, err := d.On("count", func(int) {}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Handler("count", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the docs list every event with its signature and listeners.
+func TestWriteDocs(t *testing.T) {
+	d := NewHTDispatcher()
+	Declare[schemaOrder](d, "order.created")
+	d.On("order.created", (&schemaOrder{}).onCreated)
+	d.On("user.deleted", func(int, string) {})
+
+	docs := d.Docs()
+	if len(docs) != 2 || docs[0].Name != "order.created" || !docs[0].Declared ||
+		len(docs[0].Listeners) != 1 || docs[1].Declared {
+		t.Fatalf("got %+v", docs)
+	}
+
+	var b strings.Builder
+	if err := d.WriteDocs(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"order.created(htevent.schemaOrder) declared",
+		"onCreated",
+		"user.deleted(int, string)",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Fatalf("%q not in\n%s", want, b.String())
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package htevent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// ErrScopeSetting is returned when a scope is asked to change a setting
+// shared with its parent dispatcher.
+var ErrScopeSetting = errors.New("a scope can't change the settings of its dispatcher")
+
+// scope is a child dispatcher, it forwards to its parent and tracks
+// the listeners registered through it.
+type scope struct {
+	HTDispatcher // the parent
+
+	parent      *scope // nil for a scope of a dispatcher
+	subs        map[*scopedSub]bool
+	children    map[*scope]bool
+	middlewares []Middleware
+	handler     HandlerFunc // middlewares wrapping the parent
+	closed      bool
+	stop        func() bool // stops the context watch
+	mu          sync.Mutex
+}
+
+// scopedSub is a listener registered through a scope.
+type scopedSub struct {
+	name string
+	fn   reflect.Value
+	sub  Subscription
+	s    *scope
+}
+
+func (s *scopedSub) Unsubscribe() error {
+	s.s.untrack(s)
+	return s.sub.Unsubscribe()
+}
+
+func (s *scopedSub) onEnd(f func()) {
+	if e, ok := s.sub.(ender); ok {
+		e.onEnd(f)
+	}
+}
+
+// Scope returns a child dispatcher. Emits go to the dispatcher, the listeners
+// registered through the child are removed at once by its Close.
+func (t *htDispatcher) Scope() HTDispatcher {
+	return newScope(t, nil)
+}
+
+// ScopeContext is Scope, closed when ctx is done.
+func (t *htDispatcher) ScopeContext(ctx context.Context) HTDispatcher {
+	return newScope(t, ctx)
+}
+
+func newScope(parent HTDispatcher, ctx context.Context) *scope {
+	s := &scope{
+		HTDispatcher: parent,
+		subs:         map[*scopedSub]bool{},
+		children:     map[*scope]bool{},
+	}
+	s.handler = emitHandler(parent)
+	if ctx != nil {
+		s.stop = context.AfterFunc(ctx, func() {
+			s.Close()
+		})
+	}
+	return s
+}
+
+// Scope returns a child of the scope, closed with it.
+func (s *scope) Scope() HTDispatcher {
+	return s.child(nil)
+}
+
+func (s *scope) ScopeContext(ctx context.Context) HTDispatcher {
+	return s.child(ctx)
+}
+
+func (s *scope) child(ctx context.Context) HTDispatcher {
+	c := newScope(s, ctx)
+	c.parent = s
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		c.closed = true
+		return c
+	}
+	s.children[c] = true
+	return c
+}
+
+// Unwrap returns the parent dispatcher.
+func (s *scope) Unwrap() HTDispatcher {
+	return s.HTDispatcher
+}
+
+func (s *scope) Handler(name string, args ...interface{}) error {
+	return s.HandlerContext(context.Background(), name, args...)
+}
+
+func (s *scope) HandlerContext(ctx context.Context, name string, args ...interface{}) error {
+	return s.emit(clearEmission(ctx), name, args)
+}
+
+// dispatch through the middlewares of the scope and of the parent, keeping the emission of ctx.
+func (s *scope) emit(ctx context.Context, name string, args []interface{}) error {
+	s.mu.Lock()
+	closed, handler := s.closed, s.handler
+	s.mu.Unlock()
+	if closed {
+		return ErrEventClosed
+	}
+	return handler(ctx, name, args...)
+}
+
+// Use adds middlewares wrapping the emits made through the scope only,
+// they run before the ones of the parent.
+func (s *scope) Use(mws ...Middleware) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.middlewares = append(s.middlewares, mws...)
+	s.handler = chain(s.middlewares, emitHandler(s.HTDispatcher))
+}
+
+// Request goes through the middlewares of the scope, then the ones of the parent.
+func (s *scope) Request(ctx context.Context, name string, args ...interface{}) ([]interface{}, error) {
+	return request(ctx, s.emit, name, args)
+}
+
+// EmitSticky goes through the middlewares of the scope, then the ones of the parent.
+func (s *scope) EmitSticky(name string, args ...interface{}) error {
+	return s.emit(withEmission(context.Background(), &emission{sticky: true}), name, args)
+}
+
+func (s *scope) On(name string, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return s.track(name, f, func() (Subscription, error) {
+		return s.HTDispatcher.On(name, f, opts...)
+	})
+}
+
+func (s *scope) Once(name string, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return s.track(name, f, func() (Subscription, error) {
+		return s.HTDispatcher.Once(name, f, opts...)
+	})
+}
+
+func (s *scope) OnN(name string, n int, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return s.track(name, f, func() (Subscription, error) {
+		return s.HTDispatcher.OnN(name, n, f, opts...)
+	})
+}
+
+func (s *scope) OnPriority(name string, priority int, f interface{}, opts ...ListenerOption) (Subscription, error) {
+	return s.track(name, f, func() (Subscription, error) {
+		return s.HTDispatcher.OnPriority(name, priority, f, opts...)
+	})
+}
+
+// trackScoped registers a typed listener with on, tracked by every scope
+// wrapping d so their Close removes it.
+func trackScoped(d HTDispatcher, name string, f interface{}, on func() Subscription) (Subscription, error) {
+	for {
+		switch w := d.(type) {
+		case *scope:
+			return w.track(name, f, func() (Subscription, error) {
+				return trackScoped(w.HTDispatcher, name, f, on)
+			})
+		case Wrapper:
+			d = w.Unwrap()
+		default:
+			return on(), nil
+		}
+	}
+}
+
+// register the listener with on and track it.
+func (s *scope) track(name string, f interface{}, on func() (Subscription, error)) (Subscription, error) {
+	if s.isClosed() {
+		return nil, ErrEventClosed
+	}
+
+	// not locked, on may call the listener with a sticky value
+	sub, err := on()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		sub.Unsubscribe()
+		return nil, ErrEventClosed
+	}
+	ss := &scopedSub{name: name, fn: reflect.ValueOf(f), sub: sub, s: s}
+	s.subs[ss] = true
+	s.mu.Unlock()
+
+	// the Once and OnN listeners are untracked after their last delivery
+	ss.onEnd(func() {
+		s.untrack(ss)
+	})
+	return ss, nil
+}
+
+func (s *scope) untrack(ss *scopedSub) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.subs, ss)
+}
+
+// Off removes the listeners f of the event registered through the scope only.
+func (s *scope) Off(name string, f interface{}) error {
+	fn := reflect.ValueOf(f)
+	return s.remove(func(ss *scopedSub) bool {
+		return ss.name == name && ss.fn == fn
+	}, fmt.Errorf("Listener does't exists"))
+}
+
+// Destroy removes the listeners of the event registered through the scope only.
+func (s *scope) Destroy(name string) error {
+	return s.remove(func(ss *scopedSub) bool {
+		return ss.name == name
+	}, newHTEventNotDefined(name))
+}
+
+func (s *scope) remove(match func(ss *scopedSub) bool, notFound error) error {
+	s.mu.Lock()
+	var found []*scopedSub
+	for ss := range s.subs {
+		if match(ss) {
+			found = append(found, ss)
+			delete(s.subs, ss)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(found) == 0 {
+		return notFound
+	}
+	for _, ss := range found {
+		// Once listeners may be gone already
+		ss.sub.Unsubscribe()
+	}
+	return nil
+}
+
+// Close removes every listener registered through the scope and its children.
+// The parent dispatcher isn't closed.
+func (s *scope) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	subs, children := s.subs, s.children
+	s.subs, s.children = map[*scopedSub]bool{}, map[*scope]bool{}
+	stop := s.stop
+	s.mu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+	if s.parent != nil {
+		s.parent.mu.Lock()
+		delete(s.parent.children, s)
+		s.parent.mu.Unlock()
+	}
+	for c := range children {
+		c.Close()
+	}
+	for ss := range subs {
+		ss.sub.Unsubscribe()
+	}
+	return nil
+}
+
+func (s *scope) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// The settings below are shared by every user of the parent dispatcher,
+// a scope rejects all of them with ErrScopeSetting.
+
+func (s *scope) SetMode(mode DispatchMode) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) SetEventMode(name string, mode DispatchMode) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) SetWorkerPool(workers, queueSize int) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) SetErrorHandler(f func(name string, err error)) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) SetRequestMode(name string, mode RequestMode) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) ClearSticky(name string) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) SetHistory(name string, n int) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) Debounce(name string, d time.Duration) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) Throttle(name string, interval time.Duration) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) Coalesce(name string, window time.Duration, merge MergeFunc) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) ClearOperator(name string) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) SetClock(c Clock) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) Declare(name string, argTypes ...reflect.Type) error {
+	return ErrScopeSetting
+}
+
+func (s *scope) SetStrict(strict bool) error {
+	return ErrScopeSetting
+}
+
+var _ HTDispatcher = &scope{}
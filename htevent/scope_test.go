@@ -0,0 +1,160 @@
+package htevent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// closing a scope removes the listeners of the typed topics created from it.
+func TestScopeTracksTypedTopic(t *testing.T) {
+	d := NewHTDispatcher()
+	s := d.Scope()
+	child := s.Scope()
+
+	topic, err := NewTopic[int](child, "count")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	topic.On(func(i int) { got = append(got, i) })
+	if n := d.ListenerCount("count"); n != 1 {
+		t.Fatalf("got %d listeners, want 1", n)
+	}
+
+	d.Handler("count", 1)
+	s.Close()
+	if n := d.ListenerCount("count"); n != 0 {
+		t.Fatalf("got %d listeners after Close, want 0", n)
+	}
+	d.Handler("count", 2)
+	if len(got) != 1 || got[0] != 1 {
+		t.Fatalf("got %v, want [1]", got)
+	}
+
+	// nothing is registered through a closed scope
+	if _, err := topic.On(func(i int) { got = append(got, i) }); !errors.Is(err, ErrEventClosed) {
+		t.Fatalf("On through a closed scope: got %v, want ErrEventClosed", err)
+	}
+	if n := d.ListenerCount("count"); n != 0 {
+		t.Fatalf("got %d listeners through a closed scope, want 0", n)
+	}
+}
+
+// the middlewares of a scope only wrap the emits made through it.
+func TestScopeUse(t *testing.T) {
+	d := NewHTDispatcher()
+	s := d.Scope()
+	var wrapped []string
+	s.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, name string, args ...interface{}) error {
+			wrapped = append(wrapped, name)
+			return next(ctx, name, args...)
+		}
+	})
+	d.On("a", func() {})
+	d.On("b", func() {})
+
+	d.Handler("a")
+	s.Handler("b")
+	topic, _ := NewTopic[int](s, "c")
+	topic.Emit(1)
+	if len(wrapped) != 2 || wrapped[0] != "b" || wrapped[1] != "c" {
+		t.Fatalf("got %v, want [b c]", wrapped)
+	}
+}
+
+// a scope doesn't change the settings of its parent.
+func TestScopeSettings(t *testing.T) {
+	d := NewHTDispatcher()
+	s := d.Scope()
+	var calls int
+	d.On("tick", func() { calls++ })
+
+	if err := s.SetStrict(true); !errors.Is(err, ErrScopeSetting) {
+		t.Fatalf("SetStrict: got %v, want ErrScopeSetting", err)
+	}
+	if err := s.SetMode(ModeAsync); !errors.Is(err, ErrScopeSetting) {
+		t.Fatalf("SetMode: got %v, want ErrScopeSetting", err)
+	}
+	if err := s.SetHistory("tick", 1); !errors.Is(err, ErrScopeSetting) {
+		t.Fatalf("SetHistory: got %v, want ErrScopeSetting", err)
+	}
+	if err := s.Debounce("tick", time.Hour); !errors.Is(err, ErrScopeSetting) {
+		t.Fatalf("Debounce: got %v, want ErrScopeSetting", err)
+	}
+	if err := s.SetEventMode("tick", ModeAsync); !errors.Is(err, ErrScopeSetting) {
+		t.Fatalf("SetEventMode: got %v, want ErrScopeSetting", err)
+	}
+	if err := s.Declare("tick"); !errors.Is(err, ErrScopeSetting) {
+		t.Fatalf("Declare: got %v, want ErrScopeSetting", err)
+	}
+
+	// still synchronous, not debounced and not strict
+	if err := d.Handler("tick"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Fatalf("got %d calls, want 1", calls)
+	}
+}
+
+// the Once and OnN listeners are no longer tracked after their last delivery.
+func TestScopeUntracksEnded(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+	s := d.Scope().(*scope)
+	topic, _ := NewTopic[int](s, "typed")
+
+	s.Once("a", func() {})
+	s.OnN("b", 2, func() {})
+	topic.Once(func(int) {})
+	s.On("c", func() {})
+	if n := s.tracked(); n != 4 {
+		t.Fatalf("got %d tracked, want 4", n)
+	}
+
+	d.Handler("a")
+	d.Handler("b")
+	topic.Emit(1)
+	if n := s.tracked(); n != 2 {
+		t.Fatalf("got %d tracked, want 2", n)
+	}
+	d.Handler("b")
+	if n := s.tracked(); n != 1 {
+		t.Fatalf("got %d tracked, want 1", n)
+	}
+}
+
+// the number of listeners tracked by s.
+func (s *scope) tracked() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subs)
+}
+
+// EmitSticky on a scope goes through the middlewares of the scope.
+func TestScopeEmitSticky(t *testing.T) {
+	d := NewHTDispatcher()
+	s := d.Scope()
+	var wrapped []string
+	s.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, name string, args ...interface{}) error {
+			wrapped = append(wrapped, name)
+			return next(ctx, name, args...)
+		}
+	})
+
+	if err := s.EmitSticky("cfg", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(wrapped) != 1 || wrapped[0] != "cfg" {
+		t.Fatalf("got %v, want [cfg]", wrapped)
+	}
+	var got []int
+	d.On("cfg", func(i int) { got = append(got, i) })
+	if len(got) != 1 || got[0] != 1 {
+		t.Fatalf("got %v, want the sticky [1]", got)
+	}
+}
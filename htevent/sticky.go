@@ -0,0 +1,159 @@
+package htevent
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// retained keeps the sticky values and the history of the events,
+// replayed to the listeners registered later.
+type retained struct {
+	sticky  map[string][]interface{}
+	history map[string][][]interface{}
+	limits  map[string]int // history sizes
+	mu      sync.Mutex
+}
+
+func newRetained() *retained {
+	return &retained{
+		sticky:  map[string][]interface{}{},
+		history: map[string][][]interface{}{},
+		limits:  map[string]int{},
+	}
+}
+
+func (r *retained) clearSticky(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sticky, name)
+}
+
+// drop the sticky value and the history of name, the event was destroyed.
+func (r *retained) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sticky, name)
+	delete(r.history, name)
+	delete(r.limits, name)
+}
+
+func (r *retained) setLimit(name string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n <= 0 {
+		delete(r.limits, name)
+		delete(r.history, name)
+		return
+	}
+	r.limits[name] = n
+	if h := r.history[name]; len(h) > n {
+		r.history[name] = h[len(h)-n:]
+	}
+}
+
+// record a delivery of name in its history if it keeps one,
+// and as its sticky value if it was emitted by EmitSticky.
+func (r *retained) record(name string, args []interface{}, sticky bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if sticky {
+		r.sticky[name] = args
+	}
+	n, ok := r.limits[name]
+	if !ok {
+		return
+	}
+	h := append(r.history[name], args)
+	if len(h) > n {
+		h = h[len(h)-n:]
+	}
+	r.history[name] = h
+}
+
+// return the deliveries replayed to a new listener of the concrete name,
+// its history if it keeps one, else its sticky value.
+func (r *retained) values(name string) [][]interface{} {
+	if _, ok := r.limits[name]; ok {
+		return append([][]interface{}(nil), r.history[name]...)
+	}
+	if args, ok := r.sticky[name]; ok {
+		return [][]interface{}{args}
+	}
+	return nil
+}
+
+// return the deliveries replayed to a new listener of name, a wildcard pattern
+// gets the ones of every matching event with the event name first.
+func (r *retained) replay(name string) [][]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !isPattern(name) {
+		return r.values(name)
+	}
+
+	names := map[string]bool{}
+	for n := range r.sticky {
+		names[n] = true
+	}
+	for n := range r.limits {
+		names[n] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		if MatchTopic(name, n) {
+			sorted = append(sorted, n)
+		}
+	}
+	sort.Strings(sorted)
+
+	var found [][]interface{}
+	for _, n := range sorted {
+		for _, args := range r.values(n) {
+			found = append(found, append([]interface{}{n}, args...))
+		}
+	}
+	return found
+}
+
+// EmitSticky dispatches the event and keeps its arguments, listeners registered
+// later are called with them at once. An event without listeners isn't an error.
+// The arguments are kept when they are delivered: not if a middleware rejects them
+// or the listeners can't take them, and at the end of the Debounce, Throttle or Coalesce.
+func (t *htDispatcher) EmitSticky(name string, args ...interface{}) error {
+	return t.emit(withEmission(context.Background(), &emission{sticky: true}), name, args)
+}
+
+// ClearSticky drops the sticky value of the event, if it has one.
+func (t *htDispatcher) ClearSticky(name string) error {
+	t.retained.clearSticky(name)
+	return nil
+}
+
+// SetHistory keeps the last n deliveries of the event, replayed to the listeners
+// registered later instead of the sticky value. n <= 0 stops keeping them.
+func (t *htDispatcher) SetHistory(name string, n int) error {
+	t.retained.setLimit(name, n)
+	return nil
+}
+
+// replayer is an event whose new listeners can be called with the retained deliveries.
+type replayer interface {
+	replay(ctx context.Context, id uint64, args []interface{}) error
+	report(err error)
+}
+
+// call the new listener of sub with the retained deliveries of name,
+// its errors go to the error handler.
+func (t *htDispatcher) replay(name string, ev replayer, sub Subscription) {
+	s, ok := sub.(*subscription)
+	if !ok {
+		return
+	}
+	for _, args := range t.retained.replay(name) {
+		if err := ev.replay(context.Background(), s.id, args); err != nil {
+			ev.report(err)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package htevent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// a sticky value or history entry failing validation isn't retained.
+func TestStickyRecordedAfterValidation(t *testing.T) {
+	d := NewHTDispatcher()
+	d.On("price", func(p float64) {})
+	if err := d.EmitSticky("price", 1.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EmitSticky("price", "free"); err == nil {
+		t.Fatal("a string was accepted")
+	}
+
+	d.SetHistory("qty", 3)
+	d.On("qty", func(n int) {})
+	d.Handler("qty", 1)
+	d.Handler("qty", "two")
+	d.Handler("qty", 3)
+
+	var prices []float64
+	var qtys []int
+	d.On("price", func(p float64) { prices = append(prices, p) })
+	d.On("qty", func(n int) { qtys = append(qtys, n) })
+	if len(prices) != 1 || prices[0] != 1.5 {
+		t.Fatalf("replayed prices %v, want [1.5]", prices)
+	}
+	if len(qtys) != 2 || qtys[0] != 1 || qtys[1] != 3 {
+		t.Fatalf("replayed qtys %v, want [1 3]", qtys)
+	}
+}
+
+// a sticky value rejected by a middleware isn't retained.
+func TestStickyRejectedByMiddleware(t *testing.T) {
+	d := NewHTDispatcher()
+	denied := errors.New("denied")
+	d.Use(func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, name string, args ...interface{}) error {
+			if args[0] == "secret" {
+				return denied
+			}
+			return next(ctx, name, args...)
+		}
+	})
+	d.EmitSticky("state", "open")
+	if err := d.EmitSticky("state", "secret"); !errors.Is(err, denied) {
+		t.Fatalf("got %v, want denied", err)
+	}
+
+	var got []string
+	d.On("state", func(s string) { got = append(got, s) })
+	if len(got) != 1 || got[0] != "open" {
+		t.Fatalf("replayed %v, want [open]", got)
+	}
+}
+
+// typed topic listeners, also through a scope, get the retained values.
+func TestStickyReplayTyped(t *testing.T) {
+	d := NewHTDispatcher()
+	d.EmitSticky("user", "bob")
+	d.SetHistory("count", 2)
+	for i := 1; i <= 3; i++ {
+		d.Handler("count", i)
+	}
+
+	users, _ := NewTopic[string](d, "user")
+	var got []string
+	users.On(func(s string) { got = append(got, s) })
+	if len(got) != 1 || got[0] != "bob" {
+		t.Fatalf("typed listener got %v, want [bob]", got)
+	}
+
+	s := d.Scope()
+	defer s.Close()
+	counts, _ := NewTopic[int](s, "count")
+	var n []int
+	counts.Once(func(i int) { n = append(n, i) })
+	if len(n) != 1 || n[0] != 2 {
+		t.Fatalf("scoped Once got %v, want [2]", n)
+	}
+	if c := d.ListenerCount("count"); c != 0 {
+		t.Fatalf("Once listener left after replay: %d", c)
+	}
+}
+
+// the emits of a listener with the context of a sticky delivery aren't sticky.
+func TestStickyNotInherited(t *testing.T) {
+	d := NewHTDispatcher()
+	d.On("login", func(ctx context.Context, user string) error {
+		return d.HandlerContext(ctx, "audit", user)
+	})
+	d.On("audit", func(user string) {})
+	if err := d.EmitSticky("login", "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	audits := 0
+	d.On("audit", func(user string) { audits++ })
+	if audits != 0 {
+		t.Fatalf("audit replayed %d times, want 0", audits)
+	}
+}
+
+// Destroy drops the retained values, the operator and the metrics of the event,
+// and ClearSticky without a sticky value is a no-op.
+func TestStickyDestroy(t *testing.T) {
+	d := NewHTDispatcher()
+	d.On("ready", func(v string) {})
+	d.EmitSticky("ready", "v1")
+	d.SetHistory("tick", 2)
+	d.On("tick", func(n int) {})
+	d.Handler("tick", 1)
+	if err := d.Debounce("tick", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Destroy("ready"); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Destroy("tick"); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Metrics().Topics) != 0 {
+		t.Fatalf("metrics kept: %v", d.Metrics().Topics)
+	}
+	if err := d.ClearOperator("tick"); err == nil {
+		t.Fatal("operator kept")
+	}
+
+	replayed := 0
+	d.On("ready", func(v string) { replayed++ })
+	d.On("tick", func(n int) { replayed++ })
+	if replayed != 0 {
+		t.Fatalf("replayed %d values after Destroy", replayed)
+	}
+	if err := d.ClearSticky("ready"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,161 @@
+package htevent
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Subscription is a registered listener, returned by On.
+// Unsubscribe removes exactly this listener, closures included.
+type Subscription interface {
+	Unsubscribe() error
+}
+
+type subscription struct {
+	id     uint64 // the listener id
+	remove func() bool
+	end    *endHook // nil if the subscription never ends by itself
+}
+
+// ender is a subscription telling when its listener took its last delivery.
+type ender interface {
+	onEnd(f func())
+}
+
+func (s *subscription) onEnd(f func()) {
+	if s.end != nil {
+		s.end.set(f)
+	}
+}
+
+func (s *subscription) Unsubscribe() error {
+	if !s.remove() {
+		return fmt.Errorf("Listener does't exists")
+	}
+	return nil
+}
+
+var lastListenerID uint64
+
+// counter identifies a listener and counts its remaining deliveries.
+type counter struct {
+	id   uint64
+	left int64    // < 0 means unlimited
+	end  *endHook // called when the last delivery is taken, nil if unlimited
+}
+
+func newCounter(n int) counter {
+	c := counter{
+		id:   atomic.AddUint64(&lastListenerID, 1),
+		left: int64(n),
+	}
+	if n <= 0 {
+		c.left = -1
+	} else {
+		c.end = &endHook{}
+	}
+	return c
+}
+
+// return the subscription of the listener of c.
+func (c *counter) subscription(remove func() bool) *subscription {
+	return &subscription{id: c.id, remove: remove, end: c.end}
+}
+
+// endHook calls f once the listener took its last delivery.
+type endHook struct {
+	mu    sync.Mutex
+	ended bool
+	f     func()
+}
+
+// set f, called at once if the listener already ended.
+func (h *endHook) set(f func()) {
+	h.mu.Lock()
+	ended := h.ended
+	h.f = f
+	h.mu.Unlock()
+	if ended {
+		f()
+	}
+}
+
+func (h *endHook) finish() {
+	h.mu.Lock()
+	h.ended = true
+	f := h.f
+	h.mu.Unlock()
+	if f != nil {
+		f()
+	}
+}
+
+// take one delivery. ok is false when nothing is left,
+// last is true when it took the last one and the listener should be removed.
+func (c *counter) take() (ok bool, last bool) {
+	for {
+		left := atomic.LoadInt64(&c.left)
+		if left < 0 {
+			return true, false
+		}
+		if left == 0 {
+			return false, false
+		}
+		if atomic.CompareAndSwapInt64(&c.left, left, left-1) {
+			if left == 1 {
+				c.end.finish()
+			}
+			return true, left == 1
+		}
+	}
+}
+
+// ListenerOption configures a listener registered by On, Once or OnN.
+type ListenerOption func(*listenerConfig)
+
+type listenerConfig struct {
+	timeout  time.Duration
+	priority int
+}
+
+// WithTimeout stops waiting for the listener after d, the delivery reports
+// context.DeadlineExceeded for it. The listener's context is cancelled too.
+func WithTimeout(d time.Duration) ListenerOption {
+	return func(c *listenerConfig) {
+		c.timeout = d
+	}
+}
+
+// WithPriority sets the listener priority, higher priorities are called first.
+// Listeners of the same priority keep their registration order. The default priority is 0.
+func WithPriority(priority int) ListenerOption {
+	return func(c *listenerConfig) {
+		c.priority = priority
+	}
+}
+
+func newListenerConfig(opts []ListenerOption) listenerConfig {
+	var c listenerConfig
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return c
+}
+
+// insert l before the first listener of a lower priority.
+func insertByPriority[L any](listeners []L, l L, priority func(L) int) []L {
+	p := priority(l)
+	i := len(listeners)
+	for j, o := range listeners {
+		if priority(o) < p {
+			i = j
+			break
+		}
+	}
+	listeners = append(listeners, l)
+	copy(listeners[i+1:], listeners[i:])
+	listeners[i] = l
+	return listeners
+}
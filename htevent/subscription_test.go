@@ -0,0 +1,68 @@
+package htevent
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Unsubscribe removes exactly its listener, even among identical closures.
+func TestUnsubscribeClosure(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+	var got []int
+	subs := make([]Subscription, 3)
+	for i := range subs {
+		i := i
+		subs[i], _ = d.On("tick", func() { got = append(got, i) })
+	}
+
+	if err := subs[1].Unsubscribe(); err != nil {
+		t.Fatal(err)
+	}
+	if err := subs[1].Unsubscribe(); err == nil {
+		t.Fatal("second Unsubscribe: got no error")
+	}
+	d.Handler("tick")
+	if len(got) != 2 || got[0] != 0 || got[1] != 2 {
+		t.Fatalf("got %v, want [0 2]", got)
+	}
+}
+
+// Once and OnN listeners are called n times, even by concurrent emits, then removed.
+func TestOnceConcurrent(t *testing.T) {
+	d := NewHTDispatcher()
+	var once, three atomic.Int32
+	d.Once("tick", func() { once.Add(1) })
+	d.OnN("tick", 3, func() { three.Add(1) })
+	d.On("tick", func() {})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.Handler("tick")
+		}()
+	}
+	wg.Wait()
+	if once.Load() != 1 || three.Load() != 3 {
+		t.Fatalf("got %d and %d calls, want 1 and 3", once.Load(), three.Load())
+	}
+	if n := d.ListenerCount("tick"); n != 1 {
+		t.Fatalf("got %d listeners, want 1", n)
+	}
+}
+
+// a Once listener unsubscribed before its delivery is never called.
+func TestOnceUnsubscribed(t *testing.T) {
+	d := NewHTDispatcher()
+	var called bool
+	sub, _ := d.Once("tick", func() { called = true })
+	sub.Unsubscribe()
+	d.On("tick", func() {})
+	d.Handler("tick")
+	if called {
+		t.Fatal("an unsubscribed Once listener was called")
+	}
+}
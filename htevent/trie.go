@@ -0,0 +1,150 @@
+package htevent
+
+import "strings"
+
+// Event names are hierarchical, segments are separated by '.', like order.created.
+// A subscription name may use wildcard segments, "*" matches exactly one segment
+// and "#" matches zero or more segments:
+//
+//	order.*  matches order.created, but not order or order.item.added
+//	order.#  matches order, order.created and order.item.added
+//	#        matches every event
+const (
+	topicSeparator = "."
+	wildcardOne    = "*"
+	wildcardMany   = "#"
+)
+
+// whether name is a wildcard subscription.
+func isPattern(name string) bool {
+	for _, seg := range strings.Split(name, topicSeparator) {
+		if seg == wildcardOne || seg == wildcardMany {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchTopic reports whether the event name matches the subscription pattern,
+// with the same rules as the dispatcher.
+func MatchTopic(pattern, name string) bool {
+	return matchSegs(strings.Split(pattern, topicSeparator), strings.Split(name, topicSeparator))
+}
+
+func matchSegs(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	switch pattern[0] {
+	case wildcardMany:
+		for i := 0; i <= len(name); i++ {
+			if matchSegs(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	case wildcardOne:
+		return len(name) > 0 && matchSegs(pattern[1:], name[1:])
+	}
+	return len(name) > 0 && pattern[0] == name[0] && matchSegs(pattern[1:], name[1:])
+}
+
+// topicTrie holds the wildcard subscriptions, one event per pattern.
+type topicTrie struct {
+	children map[string]*topicTrie
+	ev       *event
+	pattern  string
+}
+
+func newTopicTrie() *topicTrie {
+	return &topicTrie{children: map[string]*topicTrie{}}
+}
+
+// return the event of pattern, created by create if it's missing and create isn't nil.
+func (n *topicTrie) get(pattern string, create func() *event) *event {
+	node := n
+	for _, seg := range strings.Split(pattern, topicSeparator) {
+		child, ok := node.children[seg]
+		if !ok {
+			if create == nil {
+				return nil
+			}
+			child = newTopicTrie()
+			node.children[seg] = child
+		}
+		node = child
+	}
+	if node.ev == nil && create != nil {
+		node.ev, node.pattern = create(), pattern
+	}
+	return node.ev
+}
+
+// remove the event of pattern, return false if it doesn't exist.
+func (n *topicTrie) remove(pattern string) bool {
+	return n.removeSegs(strings.Split(pattern, topicSeparator))
+}
+
+func (n *topicTrie) removeSegs(segs []string) bool {
+	if len(segs) == 0 {
+		if n.ev == nil {
+			return false
+		}
+		n.ev, n.pattern = nil, ""
+		return true
+	}
+
+	child, ok := n.children[segs[0]]
+	if !ok || !child.removeSegs(segs[1:]) {
+		return false
+	}
+	if child.ev == nil && len(child.children) == 0 {
+		delete(n.children, segs[0])
+	}
+	return true
+}
+
+// return the events whose pattern matches name.
+func (n *topicTrie) match(name string) []*event {
+	var found []*event
+	seen := map[*event]bool{}
+	n.matchSegs(strings.Split(name, topicSeparator), func(ev *event) {
+		if !seen[ev] {
+			seen[ev] = true
+			found = append(found, ev)
+		}
+	})
+	return found
+}
+
+func (n *topicTrie) matchSegs(segs []string, found func(ev *event)) {
+	if len(segs) == 0 {
+		if n.ev != nil {
+			found(n.ev)
+		}
+	} else {
+		if child, ok := n.children[segs[0]]; ok {
+			child.matchSegs(segs[1:], found)
+		}
+		if child, ok := n.children[wildcardOne]; ok {
+			child.matchSegs(segs[1:], found)
+		}
+	}
+
+	// # takes zero up to all of the remaining segments
+	if child, ok := n.children[wildcardMany]; ok {
+		for i := 0; i <= len(segs); i++ {
+			child.matchSegs(segs[i:], found)
+		}
+	}
+}
+
+// call f with every pattern and its event.
+func (n *topicTrie) each(f func(pattern string, ev *event)) {
+	if n.ev != nil {
+		f(n.pattern, n.ev)
+	}
+	for _, child := range n.children {
+		child.each(f)
+	}
+}
@@ -0,0 +1,103 @@
+package htevent
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"order.*", "order.created", true},
+		{"order.*", "order", false},
+		{"order.*", "order.item.added", false},
+		{"order.#", "order", true},
+		{"order.#", "order.created", true},
+		{"order.#", "order.item.added", true},
+		{"order.#", "orders.created", false},
+		{"*", "order", true},
+		{"*", "order.created", false},
+		{"#", "order.item.added", true},
+		{"*.created", "order.created", true},
+		{"*.created", "order.paid", false},
+		{"order.#.added", "order.added", true},
+		{"order.#.added", "order.item.added", true},
+		{"order.#.added", "order.item.removed", false},
+		{"order.created", "order.created", true},
+	}
+	for _, tt := range tests {
+		if got := MatchTopic(tt.pattern, tt.name); got != tt.match {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.match)
+		}
+	}
+}
+
+// the trie finds the same patterns as MatchTopic among many subscriptions.
+func TestTopicTrieMatch(t *testing.T) {
+	trie := newTopicTrie()
+	var patterns []string
+	for i := 0; i < 1000; i++ {
+		patterns = append(patterns, fmt.Sprintf("svc%d.*", i), fmt.Sprintf("svc%d.#.done", i))
+	}
+	patterns = append(patterns, "#", "*.job.*")
+	events := map[*event]string{}
+	for _, p := range patterns {
+		p := p
+		trie.get(p, func() *event {
+			ev := &event{}
+			events[ev] = p
+			return ev
+		})
+	}
+
+	for _, name := range []string{"svc7.job.done", "svc7.start", "other", "svc999.job.x"} {
+		var got, want []string
+		for _, ev := range trie.match(name) {
+			got = append(got, events[ev])
+		}
+		for _, p := range patterns {
+			if MatchTopic(p, name) {
+				want = append(want, p)
+			}
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+
+	if !trie.remove("#") || trie.remove("#") {
+		t.Fatal("remove # should succeed once")
+	}
+	if len(trie.match("other")) != 0 {
+		t.Fatal("# still matches after remove")
+	}
+}
+
+// the wildcard listeners receive the event name before the arguments.
+func TestWildcardListener(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+	var got []string
+	d.On("order.*", func(name string, id int) { got = append(got, fmt.Sprintf("%s %d", name, id)) })
+	d.On("order.created", func(id int) {})
+
+	if err := d.Handler("order.created", 1); err != nil {
+		t.Fatal(err)
+	}
+	// an event with only wildcard listeners is delivered
+	if err := d.Handler("order.paid", 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Handler("order.*", 3); err == nil {
+		t.Fatal("a wildcard name was handled")
+	}
+	if len(got) != 2 || got[0] != "order.created 1" || got[1] != "order.paid 2" {
+		t.Fatalf("got %v", got)
+	}
+}
@@ -0,0 +1,321 @@
+package htevent
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Typed is a type-safe event. Listeners are checked by the compiler
+// and called directly, without reflection.
+type Typed[T any] struct {
+	listeners []*typedListener[T]
+	mu        sync.RWMutex
+
+	dispatch
+}
+
+type typedListener[T any] struct {
+	f        func(T)
+	timeout  time.Duration
+	priority int
+	counter
+}
+
+// NewTyped creates a new typed event.
+func NewTyped[T any]() *Typed[T] {
+	return &Typed[T]{}
+}
+
+// Start to listen the event.
+func (p *Typed[T]) On(f func(T), opts ...ListenerOption) Subscription {
+	return p.onN(0, f, opts)
+}
+
+// Listen the event only once.
+func (p *Typed[T]) Once(f func(T), opts ...ListenerOption) Subscription {
+	return p.onN(1, f, opts)
+}
+
+// Listen the event n times.
+func (p *Typed[T]) OnN(n int, f func(T), opts ...ListenerOption) (Subscription, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("Listen times should be positive, but got %d", n)
+	}
+	return p.onN(n, f, opts), nil
+}
+
+func (p *Typed[T]) onN(n int, f func(T), opts []ListenerOption) Subscription {
+	cfg := newListenerConfig(opts)
+	l := &typedListener[T]{
+		f:        f,
+		timeout:  cfg.timeout,
+		priority: cfg.priority,
+		counter:  newCounter(n),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = insertByPriority(p.listeners, l, func(l *typedListener[T]) int {
+		return l.priority
+	})
+
+	return l.subscription(func() bool {
+		return p.remove(l.id)
+	})
+}
+
+// remove the listener of id, return false if it doesn't exist.
+func (p *Typed[T]) remove(id uint64) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, l := range p.listeners {
+		if l.id == id {
+			p.listeners = append(p.listeners[:i], p.listeners[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Emit calls every listener with v according to the dispatch mode.
+func (p *Typed[T]) Emit(v T) error {
+	return p.EmitContext(context.Background(), v)
+}
+
+// EmitContext is Emit that stops waiting for the listeners when ctx is done.
+func (p *Typed[T]) EmitContext(ctx context.Context, v T) error {
+	return p.run(ctx, p.calls(v))
+}
+
+// return the calls of the listeners with v, by priority.
+// The Once and OnN listeners reaching their count are removed.
+func (p *Typed[T]) calls(v T) []call {
+	p.mu.RLock()
+	calls := make([]call, 0, len(p.listeners))
+	var done []uint64
+	for _, l := range p.listeners {
+		ok, last := l.take()
+		if !ok {
+			continue
+		}
+		if last {
+			done = append(done, l.id)
+		}
+		f := l.f
+		calls = append(calls, call{
+			fn: func(context.Context) error {
+				f(v)
+				return nil
+			},
+			timeout:  l.timeout,
+			priority: l.priority,
+		})
+	}
+	p.mu.RUnlock()
+
+	for _, id := range done {
+		p.remove(id)
+	}
+	return calls
+}
+
+// SetMode changes how the listeners are called, ModeConcurrent by default.
+func (p *Typed[T]) SetMode(mode DispatchMode) {
+	p.setMode(mode)
+}
+
+// SetWorkerPool sets the pool used by ModePool, see HTEvent.SetWorkerPool.
+func (p *Typed[T]) SetWorkerPool(workers, queueSize int) {
+	p.setWorkerPool(workers, queueSize)
+}
+
+// SetErrorHandler receives the panics of the listeners called in ModeAsync and ModePool.
+func (p *Typed[T]) SetErrorHandler(f func(err error)) {
+	p.setErrorHandler(f)
+}
+
+// Close waits for the pending async deliveries, Emit fails after it.
+func (p *Typed[T]) Close() error {
+	p.close()
+	return nil
+}
+
+// listenerCalls returns the calls of the arguments coming from the reflective HTDispatcher.Handler.
+func (p *Typed[T]) listenerCalls(args []interface{}) []call {
+	v, _ := p.value(args)
+	return p.calls(v)
+}
+
+// validate checks the arguments coming from the reflective HTDispatcher.Handler.
+func (p *Typed[T]) validate(args []interface{}) error {
+	_, err := p.value(args)
+	return err
+}
+
+// return the value of the arguments coming from the reflective HTDispatcher.Handler.
+func (p *Typed[T]) value(args []interface{}) (T, error) {
+	var zero T
+	if len(args) != 1 {
+		return zero, fmt.Errorf("Argument length expected 1, but got %d", len(args))
+	}
+	v, ok := args[0].(T)
+	if !ok {
+		// an untyped nil is the zero value of interfaces, pointers, maps...
+		want := reflect.TypeOf((*T)(nil)).Elem()
+		if args[0] != nil || !assignable(nil, want) {
+			return zero, fmt.Errorf("Argument Error. Args[0] expected %s, but got %s",
+				typeString(want), typeString(reflect.TypeOf(args[0])))
+		}
+	}
+	return v, nil
+}
+
+// replay calls the listener of id with retained arguments, see HTDispatcher.EmitSticky.
+func (p *Typed[T]) replay(ctx context.Context, id uint64, args []interface{}) error {
+	var l *typedListener[T]
+	p.mu.RLock()
+	for _, o := range p.listeners {
+		if o.id == id {
+			l = o
+			break
+		}
+	}
+	p.mu.RUnlock()
+	if l == nil {
+		return nil
+	}
+
+	v, err := p.value(args)
+	if err != nil {
+		return err
+	}
+	ok, last := l.take()
+	if !ok {
+		return nil
+	}
+	if last {
+		p.remove(id)
+	}
+	return call{fn: func(context.Context) error {
+		l.f(v)
+		return nil
+	}, timeout: l.timeout}.invoke(ctx)
+}
+
+// typedEvent is the untyped side of Typed, stored by the dispatcher.
+type typedEvent interface {
+	listenerCalls(args []interface{}) []call
+	measure(calls []call) []call
+	exec(ctx context.Context, calls []call, measure bool) error
+	validate(args []interface{}) error
+	listenerCount() int
+	listenerNames() []string
+	signature() []reflect.Type
+	modeSetter
+}
+
+// topicRegistry is implemented by dispatchers that can hold typed topics.
+type topicRegistry interface {
+	typedTopic(name string, create func() typedEvent) (typedEvent, error)
+	replay(name string, ev replayer, sub Subscription)
+}
+
+// Wrapper is implemented by dispatchers wrapping another one,
+// so typed topics can be created through them.
+type Wrapper interface {
+	Unwrap() HTDispatcher
+}
+
+// return the registry of d, unwrapping it if needed.
+func registry(d HTDispatcher) (topicRegistry, bool) {
+	for {
+		if reg, ok := d.(topicRegistry); ok {
+			return reg, true
+		}
+		w, ok := d.(Wrapper)
+		if !ok {
+			return nil, false
+		}
+		d = w.Unwrap()
+	}
+}
+
+// Topic is a typed event of a dispatcher. It coexists with the reflective API:
+// Handler(name, v) reaches the typed listeners, and Emit(v) reaches
+// the listeners registered with On(name, f).
+type Topic[T any] struct {
+	name string
+	d    HTDispatcher
+	reg  topicRegistry
+	ev   *Typed[T]
+}
+
+// NewTopic returns the typed topic name of d. Topics created with the same name
+// and type share their listeners.
+func NewTopic[T any](d HTDispatcher, name string) (*Topic[T], error) {
+	if isPattern(name) {
+		return nil, fmt.Errorf("%s is a wildcard name, it can't be a typed topic", name)
+	}
+
+	reg, ok := registry(d)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support typed topics", d)
+	}
+
+	te, err := reg.typedTopic(name, func() typedEvent { return NewTyped[T]() })
+	if err != nil {
+		return nil, err
+	}
+	ev, ok := te.(*Typed[T])
+	if !ok {
+		return nil, fmt.Errorf("%s topic is already typed as %T", name, te)
+	}
+	return &Topic[T]{name: name, d: d, reg: reg, ev: ev}, nil
+}
+
+// Name returns the event name of the topic.
+func (t *Topic[T]) Name() string {
+	return t.name
+}
+
+// Start to listen the topic.
+func (t *Topic[T]) On(f func(T), opts ...ListenerOption) (Subscription, error) {
+	return t.onN(0, f, opts)
+}
+
+// Listen the topic only once.
+func (t *Topic[T]) Once(f func(T), opts ...ListenerOption) (Subscription, error) {
+	return t.onN(1, f, opts)
+}
+
+// Listen the topic n times.
+func (t *Topic[T]) OnN(n int, f func(T), opts ...ListenerOption) (Subscription, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("Listen times should be positive, but got %d", n)
+	}
+	return t.onN(n, f, opts)
+}
+
+// register the listener, tracked by the scopes the topic was created from,
+// and call it with the retained values of the topic.
+// Nothing is registered through a closed scope, ErrEventClosed is returned.
+func (t *Topic[T]) onN(n int, f func(T), opts []ListenerOption) (Subscription, error) {
+	return trackScoped(t.d, t.name, f, func() Subscription {
+		sub := t.ev.onN(n, f, opts)
+		t.reg.replay(t.name, t.ev, sub)
+		return sub
+	})
+}
+
+// Emit dispatches v through the dispatcher middlewares to the typed listeners,
+// and to the reflective and wildcard listeners of the same event name.
+func (t *Topic[T]) Emit(v T) error {
+	return t.EmitContext(context.Background(), v)
+}
+
+// EmitContext is Emit that stops waiting for the listeners when ctx is done.
+func (t *Topic[T]) EmitContext(ctx context.Context, v T) error {
+	return t.d.HandlerContext(ctx, t.name, v)
+}
@@ -0,0 +1,116 @@
+package htevent
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// a nil value reaches the typed and reflective listeners of nilable types.
+func TestTopicEmitNil(t *testing.T) {
+	d := NewHTDispatcher()
+	errs, err := NewTopic[error](d, "failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var typed, reflective []error
+	errs.On(func(err error) { typed = append(typed, err) })
+	d.On("failed", func(err error) { reflective = append(reflective, err) })
+
+	if err := errs.Emit(nil); err != nil {
+		t.Fatal(err)
+	}
+	boom := errors.New("boom")
+	if err := errs.Emit(boom); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Handler("failed", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, got := range [][]error{typed, reflective} {
+		if len(got) != 3 || got[0] != nil || got[1] != boom || got[2] != nil {
+			t.Fatalf("got %v, want [<nil> boom <nil>]", got)
+		}
+	}
+
+	names, _ := NewTopic[[]string](d, "names")
+	got := []string{"not called"}
+	names.On(func(s []string) { got = s })
+	if err := d.Handler("names", nil); err != nil || got != nil {
+		t.Fatalf("got %v %v, want a nil slice", got, err)
+	}
+}
+
+// an untyped nil isn't a value of a non nilable type.
+func TestTopicEmitNilNotNilable(t *testing.T) {
+	d := NewHTDispatcher()
+	counts, _ := NewTopic[int](d, "count")
+	counts.On(func(int) {})
+	err := d.Handler("count", nil)
+	if err == nil || !strings.Contains(err.Error(), "expected int, but got nil") {
+		t.Fatalf("got %v", err)
+	}
+}
+
+// a typed event calls its listeners with the value, Once and OnN count the deliveries.
+func TestTypedListeners(t *testing.T) {
+	ev := NewTyped[string]()
+	ev.SetMode(ModeSync)
+	var got []string
+	ev.On(func(s string) { got = append(got, "on:"+s) })
+	ev.Once(func(s string) { got = append(got, "once:"+s) })
+	if _, err := ev.OnN(2, func(s string) { got = append(got, "n:"+s) }); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"a", "b", "c"} {
+		if err := ev.Emit(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := "on:a once:a n:a on:b n:b on:c"
+	if s := strings.Join(got, " "); s != want {
+		t.Fatalf("got %s, want %s", s, want)
+	}
+}
+
+// OnN rejects n <= 0 like HTEvent.OnN.
+func TestTypedOnNNotPositive(t *testing.T) {
+	d := NewHTDispatcher()
+	topic, _ := NewTopic[int](d, "count")
+	for _, n := range []int{0, -1} {
+		if _, err := NewTyped[int]().OnN(n, func(int) {}); err == nil {
+			t.Fatalf("Typed.OnN(%d): got no error", n)
+		}
+		if _, err := topic.OnN(n, func(int) {}); err == nil {
+			t.Fatalf("Topic.OnN(%d): got no error", n)
+		}
+		if _, err := d.OnN("count", n, func(int) {}); err == nil {
+			t.Fatalf("OnN(%d): got no error", n)
+		}
+	}
+	if c := d.ListenerCount("count"); c != 0 {
+		t.Fatalf("got %d listeners, want 0", c)
+	}
+}
+
+// a topic shares its event with the reflective listeners of the dispatcher.
+func TestTopicWithReflective(t *testing.T) {
+	d := NewHTDispatcher()
+	d.SetMode(ModeSync)
+	topic, _ := NewTopic[int](d, "count")
+	var typed, reflective []int
+	topic.On(func(i int) { typed = append(typed, i) })
+	d.On("count", func(i int) { reflective = append(reflective, i) })
+
+	topic.Emit(1)
+	d.Handler("count", 2)
+	if err := d.Handler("count", "x"); err == nil {
+		t.Fatal("a string was delivered to an int topic")
+	}
+	if len(typed) != 2 || typed[1] != 2 || len(reflective) != 2 || reflective[0] != 1 {
+		t.Fatalf("got typed %v and reflective %v, want [1 2]", typed, reflective)
+	}
+	if _, err := NewTopic[string](d, "count"); err == nil {
+		t.Fatal("NewTopic with another type: got no error")
+	}
+}
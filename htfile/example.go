@@ -10,6 +10,8 @@ func HTFile_test() {
 	defer file.Close()
 
 	file.SetFormat(CutTypeDay) 
+	// 保留最近3个历史文件，切分后压缩
+	file.SetRetention(&Retention{MaxFiles: 3, Compress: true})
 	_, err := file.Writef("first format %v string\n", 0)
 	if err != nil {
         fmt.Println("error ", err)
@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 	"fmt"
+	"path/filepath"
 	"strings"
 )
 
@@ -31,6 +32,9 @@ type HTFile struct {
 	filenameMu   sync.Mutex
 	destFilename string
 	destKey      string 
+
+	retention *Retention
+	retainWg  sync.WaitGroup
 }
 
 func Open(filename string) *HTFile {
@@ -57,6 +61,13 @@ func (f *HTFile) SetMode(mode os.FileMode) {
 	f.mode = mode
 }
 
+// 设置切分文件的保留策略，每次切分后对旧文件执行
+func (f *HTFile) SetRetention(r *Retention) {
+	f.filenameMu.Lock()
+	f.retention = r
+	f.filenameMu.Unlock()
+}
+
 func (f *HTFile) ResetFile() error {
 	now := nowFunc()
 	f.filenameMu.Lock()
@@ -67,15 +78,19 @@ func (f *HTFile) ResetFile() error {
 
 	file, err := os.OpenFile(name, f.flag, f.mode)
 	if err != nil {
-		f.filenameMu.Unlock()
 		return err
 	}
 
+	closed := ""
 	if f.file != nil {
 		f.file.Close()
+		if f.destFilename != name {
+			closed = f.destFilename
+		}
 	}
 
 	f.file, f.destFilename, f.destKey = file, name, key
+	f.retain(closed)
 	return nil
 }
 
@@ -84,8 +99,10 @@ func (f *HTFile) Writeb(b []byte) (n int, err error) {
 	f.filenameMu.Lock()
 	key := now.Format(f.cutType)
 	if key != f.destKey {
+		closed := ""
 		if f.file != nil {
 			f.file.Close()
+			closed = f.destFilename
 		}
 
 		name := f.orgFilename + "." + key
@@ -97,6 +114,7 @@ func (f *HTFile) Writeb(b []byte) (n int, err error) {
 		}
 
 		f.destFilename, f.destKey = name, key
+		f.retain(closed)
 	}
 	f.filenameMu.Unlock()
 
@@ -116,7 +134,38 @@ func (f *HTFile) Writef(format interface{}, v ...interface{}) (n int, err error)
 }
 
 func (f *HTFile) Close() error {
-	return f.file.Close()
+	err := f.file.Close()
+	// 等待未完成的保留策略处理
+	f.retainWg.Wait()
+	return err
+}
+
+// 切分后在后台执行保留策略，调用时需持有filenameMu
+func (f *HTFile) retain(closed string) {
+	if f.retention == nil {
+		return
+	}
+	r, pattern, active := f.retention, f.orgFilename+".*", f.destFilename
+	match := cutMatcher(filepath.Base(f.orgFilename), f.cutType)
+	f.retainWg.Add(1)
+	go func() {
+		defer f.retainWg.Done()
+		if err := r.Run(closed, pattern, active, match); err != nil {
+			fmt.Fprintf(os.Stderr, "htfile retention %s: %s\n", f.orgFilename, err)
+		}
+	}()
+}
+
+// 只接受 base.<切分时间>，以及压缩后的 base.<切分时间>.gz
+func cutMatcher(base, cutType string) func(name string) bool {
+	return func(name string) bool {
+		key, ok := strings.CutPrefix(strings.TrimSuffix(name, ".gz"), base+".")
+		if !ok {
+			return false
+		}
+		_, err := time.Parse(cutType, key)
+		return err == nil
+	}
 }
 
 func formatLog(f interface{}, v ...interface{}) string {
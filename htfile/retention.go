@@ -0,0 +1,197 @@
+package htfile
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Archiver 处理已经关闭的切分文件，比如移动到其他目录或交给上传程序。
+// Archive返回nil后文件如果还在原位置，会继续参与保留策略的清理。
+type Archiver interface {
+	Archive(path string) error
+}
+
+// ArchiverFunc 让普通函数可以作为Archiver使用
+type ArchiverFunc func(path string) error
+
+func (fn ArchiverFunc) Archive(path string) error {
+	return fn(path)
+}
+
+// DirArchiver 把已关闭的文件移动到Dir目录下，
+// 目录中已有同名文件时不覆盖，改名为 name.1.log、name.2.log ...
+type DirArchiver struct {
+	Dir string
+}
+
+func (a *DirArchiver) Archive(path string) error {
+	if err := os.MkdirAll(a.Dir, 0755); err != nil {
+		return err
+	}
+	dst, err := freeName(a.Dir, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	return os.Rename(path, dst)
+}
+
+// 返回dir中不存在的文件名，base已存在时在扩展名前加序号
+func freeName(dir, base string) (string, error) {
+	ext := filepath.Ext(base)
+	if ext == ".gz" {
+		ext = filepath.Ext(strings.TrimSuffix(base, ext)) + ext
+	}
+	stem := strings.TrimSuffix(base, ext)
+
+	name := filepath.Join(dir, base)
+	for n := 1; ; n++ {
+		_, err := os.Lstat(name)
+		if os.IsNotExist(err) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		name = filepath.Join(dir, fmt.Sprintf("%s.%d%s", stem, n, ext))
+	}
+}
+
+// Retention 切分文件的保留策略，HTFile和htlog的文件输出共用这一套逻辑。
+// 每次切分后先处理刚关闭的文件(压缩、归档)，再按数量、时间、总大小清理历史文件，
+// 各项为0时表示不限制。
+type Retention struct {
+	MaxFiles int           // 最多保留的历史文件个数
+	MaxAge   time.Duration // 历史文件最长保留时间，按修改时间计算
+	MaxBytes int64         // 历史文件总大小上限，超出时从最旧的开始删除
+	Compress bool          // 是否gzip压缩已关闭的文件
+	Archiver Archiver      // 已关闭文件的归档处理，可为nil
+
+	mu sync.Mutex
+}
+
+// Run 处理刚关闭的文件closed(为空时跳过)，然后清理pattern匹配到、并且文件名通过match的历史文件，
+// match只应接受切分生成的文件名，避免删除同前缀的其他文件，为nil时不过滤。
+// active是当前正在写入的文件，不会被清理。
+// 出错时继续处理剩余文件，返回遇到的第一个错误。
+func (r *Retention) Run(closed, pattern, active string, match func(name string) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var first error
+	if closed != "" {
+		first = r.archive(closed)
+	}
+	if err := r.prune(pattern, active, match); err != nil && first == nil {
+		first = err
+	}
+	return first
+}
+
+func (r *Retention) archive(path string) error {
+	if r.Compress && !strings.HasSuffix(path, ".gz") {
+		gz, err := compressFile(path)
+		if err != nil {
+			return fmt.Errorf("compress %s: %s", path, err)
+		}
+		path = gz
+	}
+	if r.Archiver != nil {
+		if err := r.Archiver.Archive(path); err != nil {
+			return fmt.Errorf("archive %s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+func (r *Retention) prune(pattern, active string, match func(name string) bool) error {
+	if r.MaxFiles <= 0 && r.MaxAge <= 0 && r.MaxBytes <= 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+
+	active = filepath.Clean(active)
+	infos := make([]retainedFile, 0, len(matches))
+	for _, name := range matches {
+		if filepath.Clean(name) == active || (match != nil && !match(filepath.Base(name))) {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		infos = append(infos, retainedFile{name, info})
+	}
+
+	// 从新到旧排列，保留靠前的文件
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ModTime().After(infos[j].ModTime())
+	})
+
+	var first error
+	var total int64
+	now := nowFunc()
+	for i, file := range infos {
+		total += file.Size()
+		if (r.MaxFiles > 0 && i >= r.MaxFiles) ||
+			(r.MaxAge > 0 && file.ModTime().Add(r.MaxAge).Before(now)) ||
+			(r.MaxBytes > 0 && total > r.MaxBytes) {
+			if err := os.Remove(file.path); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+type retainedFile struct {
+	path string
+	os.FileInfo
+}
+
+// 压缩为path.gz并删除原文件，保留原文件的修改时间，以便按时间清理
+func compressFile(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	name := path + ".gz"
+	dst, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode())
+	if err != nil {
+		return "", err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name)
+		return "", err
+	}
+
+	os.Chtimes(name, info.ModTime(), info.ModTime())
+	src.Close()
+	return name, os.Remove(path)
+}
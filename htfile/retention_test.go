@@ -0,0 +1,81 @@
+package htfile
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDirArchiverKeepsExisting(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive")
+	a := &DirArchiver{Dir: archive}
+	for i, content := range []string{"first", "second", "third"} {
+		name := filepath.Join(dir, "app.001.log.gz")
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Archive(name); err != nil {
+			t.Fatal(i, err)
+		}
+	}
+
+	want := map[string]string{
+		"app.001.log.gz":   "first",
+		"app.001.1.log.gz": "second",
+		"app.001.2.log.gz": "third",
+	}
+	entries, _ := os.ReadDir(archive)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+		b, _ := os.ReadFile(filepath.Join(archive, e.Name()))
+		if want[e.Name()] != string(b) {
+			t.Errorf("%s: %q", e.Name(), b)
+		}
+	}
+	sort.Strings(names)
+	if len(names) != len(want) {
+		t.Fatal(names)
+	}
+}
+
+// 保留策略只清理切分生成的文件，同前缀的其他文件不受影响
+func TestRetentionKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "data")
+	old := time.Date(2023, 1, 1, 0, 0, 0, 0, time.Local)
+	for i, name := range []string{"data.conf", "data.db", "data.230101", "data.230102.gz"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mt := old.Add(time.Duration(i) * time.Hour)
+		os.Chtimes(path, mt, mt)
+	}
+
+	defer func(f func() time.Time) { nowFunc = f }(nowFunc)
+	nowFunc = func() time.Time { return time.Date(2023, 1, 3, 12, 0, 0, 0, time.Local) }
+	f := Open(base)
+	f.SetFormat(CutTypeDay)
+	f.SetRetention(&Retention{MaxFiles: 1})
+	if _, err := f.Write("x"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	for name, kept := range map[string]bool{
+		"data.conf":      true,
+		"data.db":        true,
+		"data.230101":    false,
+		"data.230102.gz": true,
+		"data.230103":    true,
+	} {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if kept != (err == nil) {
+			t.Errorf("%s: kept %v, stat %v", name, kept, err)
+		}
+	}
+}
@@ -21,6 +21,7 @@ type connHTLog struct {
 	Level          string `json:"level"`
 	LogLevel       int
 	illNetFlag     bool //网络异常标记
+	outputOptions
 }
 
 func (c *connHTLog) Init(jsonConfig string) error {
@@ -43,10 +44,6 @@ func (c *connHTLog) Init(jsonConfig string) error {
 }
 
 func (c *connHTLog) LogWrite(when time.Time, msgText interface{}, level int) (err error) {
-	if level > c.LogLevel {
-		return nil
-	}
-
 	msg, ok := msgText.(*loginfo)
 	if !ok {
 		return
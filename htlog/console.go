@@ -46,6 +46,7 @@ type consoleHTLog struct {
 	Level    string `json:"level"`
 	Colorful bool   `json:"color"`
 	LogLevel int
+	outputOptions
 }
 
 func (c *consoleHTLog) Init(jsonConfig string) error {
@@ -70,9 +71,6 @@ func (c *consoleHTLog) Init(jsonConfig string) error {
 }
 
 func (c *consoleHTLog) LogWrite(when time.Time, msgText interface{}, level int) error {
-	if level > c.LogLevel {
-		return nil
-	}
 	msg, ok := msgText.(string)
 	if !ok {
 		return nil
@@ -0,0 +1,323 @@
+package htlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output 是一个日志输出的配置和当前等级
+type Output struct {
+	Name   string `json:"name"`
+	Level  string `json:"level"`
+	Config string `json:"config"`
+}
+
+// Outputs 返回配置的日志输出
+func (this *LocalHTLog) Outputs() []Output {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	outputs := make([]Output, 0, len(this.outputs))
+	for _, l := range this.outputs {
+		outputs = append(outputs, Output{Name: l.name, Level: levelName(int(l.level.Load())), Config: l.config})
+	}
+	return outputs
+}
+
+// 等级对应的名字
+func levelName(l int) string {
+	if l >= 0 && l < len(levelPrefix) {
+		return levelPrefix[l]
+	}
+	return ""
+}
+
+// 适配器接受的最低优先级，没有LogLevel字段的适配器接受所有日志
+func outputLevel(h HTLog) int {
+	if l, ok := logLevelField(h); ok {
+		return l
+	}
+	return LevelTrace
+}
+
+// 适配器的LogLevel字段
+func logLevelField(h HTLog) (int, bool) {
+	v := reflect.Indirect(reflect.ValueOf(h))
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+	f := v.FieldByName("LogLevel")
+	if !f.IsValid() || f.Kind() != reflect.Int {
+		return 0, false
+	}
+	return int(f.Int()), true
+}
+
+// 是否配置了adapterName输出
+func (this *LocalHTLog) hasOutput(adapterName string) bool {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, l := range this.outputs {
+		if l.name == adapterName {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLevel 修改日志输出的等级，不重新初始化输出，等级没有变化时什么都不做
+func (this *LocalHTLog) SetLevel(adapterName string, level string) error {
+	l, ok := LevelMap[level]
+	if !ok {
+		return fmt.Errorf("unknown level %s", level)
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for _, output := range this.outputs {
+		if output.name != adapterName {
+			continue
+		}
+		if int(output.level.Load()) == l {
+			return nil
+		}
+		// 配置中也修改等级，Outputs返回和重新设置时使用
+		conf := map[string]interface{}{}
+		if output.config != "" {
+			if err := json.Unmarshal([]byte(output.config), &conf); err != nil {
+				return err
+			}
+		}
+		conf["level"] = level
+		delete(conf, "LogLevel")
+		b, _ := json.Marshal(conf)
+		output.config = string(b)
+		output.level.Store(int32(l))
+		this.updateLevel()
+		return nil
+	}
+	return fmt.Errorf("adaptername %s is not set", adapterName)
+}
+
+// SetModuleLevel 设置调用位置以module开头的日志的等级，在输出之前过滤，
+// 有多个匹配时最长的module生效。module为空匹配所有日志，level为空删除设置
+func (this *LocalHTLog) SetModuleLevel(module string, level string) error {
+	this.modLock.Lock()
+	defer this.modLock.Unlock()
+	if level == "" {
+		delete(this.modules, module)
+		return nil
+	}
+	l, ok := LevelMap[level]
+	if !ok {
+		return fmt.Errorf("unknown level %s", level)
+	}
+	if this.modules == nil {
+		this.modules = map[string]int{}
+	}
+	this.modules[module] = l
+	return nil
+}
+
+// ModuleLevels 返回模块的日志等级
+func (this *LocalHTLog) ModuleLevels() map[string]string {
+	this.modLock.RLock()
+	defer this.modLock.RUnlock()
+	levels := make(map[string]string, len(this.modules))
+	for m, l := range this.modules {
+		levels[m] = levelPrefix[l]
+	}
+	return levels
+}
+
+// 调用位置src的level日志是否输出
+func (this *LocalHTLog) moduleEnabled(src string, level int) bool {
+	this.modLock.RLock()
+	defer this.modLock.RUnlock()
+	if len(this.modules) == 0 {
+		return true
+	}
+	match, enabled := -1, true
+	for m, l := range this.modules {
+		if len(m) > match && strings.HasPrefix(src, m) {
+			match, enabled = len(m), level <= l
+		}
+	}
+	return enabled
+}
+
+// Rotate 立即轮转文件输出的日志文件
+func (this *LocalHTLog) Rotate() error {
+	var f *fileHTLog
+	this.lock.Lock()
+	for _, l := range this.outputs {
+		if fl, ok := l.HTLog.(*fileHTLog); ok {
+			f = fl
+			break
+		}
+	}
+	this.lock.Unlock()
+	// 轮转时不持有锁，压缩和清理可能较慢
+	if f == nil {
+		return fmt.Errorf("adaptername %s is not set", AdapterFile)
+	}
+	return f.Rotate()
+}
+
+// DebugHandler 返回运行时查看和调整日志的http.Handler，可以挂在任意路径下，
+// 按最后一段路径区分：
+//
+//	GET  .../outputs                          日志输出、等级和模块等级
+//	POST .../level?adapter=file&level=DEBG    修改输出的等级
+//	POST .../level?module=app/db&level=TRAC   修改模块的等级，level为空删除
+//	GET  .../tail?n=100&level=WARN&path=db    最近的日志，需要memory输出
+//	POST .../rotate                           轮转日志文件
+//
+// auth 返回false的请求被拒绝，没有auth时不检查
+func (this *LocalHTLog) DebugHandler(auth ...func(r *http.Request) bool) http.Handler {
+	return &debugHandler{log: this, auth: auth}
+}
+
+type debugHandler struct {
+	log  *LocalHTLog
+	auth []func(r *http.Request) bool
+}
+
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, auth := range h.auth {
+		if !auth(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	switch path.Base(r.URL.Path) {
+	case "outputs":
+		if !method(w, r, http.MethodGet) {
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"outputs": h.log.Outputs(),
+			"modules": h.log.ModuleLevels(),
+		})
+	case "level":
+		if !method(w, r, http.MethodPost) {
+			return
+		}
+		h.setLevel(w, r)
+	case "tail":
+		if !method(w, r, http.MethodGet) {
+			return
+		}
+		h.tail(w, r)
+	case "rotate":
+		if !method(w, r, http.MethodPost) {
+			return
+		}
+		if err := h.log.Rotate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *debugHandler) setLevel(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	level := q.Get("level")
+	var err error
+	switch {
+	case q.Has("adapter"):
+		err = h.log.SetLevel(q.Get("adapter"), level)
+	case q.Has("module"):
+		err = h.log.SetModuleLevel(q.Get("module"), level)
+	default:
+		err = fmt.Errorf("adapter or module is required")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 最近的日志，每行一条，格式同控制台输出
+func (h *debugHandler) tail(w http.ResponseWriter, r *http.Request) {
+	if !h.log.hasOutput(AdapterMemory) || memoryAdapter.ring.Load() == nil {
+		http.Error(w, fmt.Sprintf("adaptername %s is not set", AdapterMemory), http.StatusNotFound)
+		return
+	}
+	q := r.URL.Query()
+	query := MemoryQuery{Level: q.Get("level"), Path: q.Get("path"), Limit: 100}
+	if n, err := strconv.Atoi(q.Get("n")); err == nil {
+		query.Limit = n
+	}
+	if since, err := time.ParseDuration(q.Get("since")); err == nil {
+		query.Since = time.Now().Add(-since)
+	}
+	for _, f := range q["field"] {
+		if k, v, ok := strings.Cut(f, "="); ok {
+			if query.Fields == nil {
+				query.Fields = map[string]string{}
+			}
+			query.Fields[k] = v
+		}
+	}
+
+	var b strings.Builder
+	for _, e := range QueryMemory(query) {
+		b.WriteString(e.Time.Format(h.log.timeFormat) + " [" + e.Level + "] " + "[" + e.Path + "] " + e.Content + "\n")
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
+
+func method(w http.ResponseWriter, r *http.Request, m string) bool {
+	if r.Method != m {
+		w.Header().Set("Allow", m)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Outputs returns the outputs of the defaultHTLog.
+func Outputs() []Output {
+	return defaultHTLog.Outputs()
+}
+
+// SetLevel changes the level of an output of the defaultHTLog.
+func SetLevel(adapterName string, level string) error {
+	return defaultHTLog.SetLevel(adapterName, level)
+}
+
+// SetModuleLevel sets the level of a module of the defaultHTLog.
+func SetModuleLevel(module string, level string) error {
+	return defaultHTLog.SetModuleLevel(module, level)
+}
+
+// Rotate rotates the log file of the defaultHTLog.
+func Rotate() error {
+	return defaultHTLog.Rotate()
+}
+
+// DebugHandler returns the debug http.Handler of the defaultHTLog.
+func DebugHandler(auth ...func(r *http.Request) bool) http.Handler {
+	return defaultHTLog.DebugHandler(auth...)
+}
@@ -0,0 +1,203 @@
+package htlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// 用带认证的DebugHandler发请求，返回状态码和内容
+func debugRequest(t *testing.T, h http.Handler, method, target string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/debug/log/"+target, nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	body, _ := io.ReadAll(w.Result().Body)
+	return w.Code, string(body)
+}
+
+func adminOnly(r *http.Request) bool {
+	return r.Header.Get("X-Admin-Token") == "secret"
+}
+
+func TestDebugHandlerAuth(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	h := l.DebugHandler(adminOnly)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/log/outputs", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("got %d without token, want 401", w.Code)
+	}
+	if code, _ := debugRequest(t, h, http.MethodGet, "outputs"); code != http.StatusOK {
+		t.Fatalf("got %d with token, want 200", code)
+	}
+}
+
+func TestDebugHandlerLevels(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.SetHTLog(AdapterMemory, `{"entries":100}`)
+	h := l.DebugHandler(adminOnly)
+
+	if code, body := debugRequest(t, h, http.MethodPost, "level?adapter=memory&level=WARN"); code != http.StatusNoContent {
+		t.Fatalf("adapter level: %d %s", code, body)
+	}
+	if code, body := debugRequest(t, h, http.MethodPost, "level?module=app/db&level=TRAC"); code != http.StatusNoContent {
+		t.Fatalf("module level: %d %s", code, body)
+	}
+
+	code, body := debugRequest(t, h, http.MethodGet, "outputs")
+	var got struct {
+		Outputs []Output          `json:"outputs"`
+		Modules map[string]string `json:"modules"`
+	}
+	if err := json.Unmarshal([]byte(body), &got); err != nil || code != http.StatusOK {
+		t.Fatalf("outputs: %d %s %v", code, body, err)
+	}
+	levels := map[string]string{}
+	for _, o := range got.Outputs {
+		levels[o.Name] = o.Level
+	}
+	if levels[AdapterMemory] != "WARN" {
+		t.Fatalf("outputs: %+v", got.Outputs)
+	}
+	if got.Modules["app/db"] != "TRAC" {
+		t.Fatalf("modules: %v", got.Modules)
+	}
+
+	// level为空删除模块的设置
+	debugRequest(t, h, http.MethodPost, "level?module=app/db&level=")
+	if levels := l.ModuleLevels(); len(levels) != 0 {
+		t.Fatalf("module level not removed: %v", levels)
+	}
+}
+
+// 修改等级不重新初始化输出，保留memory中的日志，等级没有变化也成功
+func TestSetLevelInPlace(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.Reset()
+	l.SetHTLog(AdapterMemory, `{"entries":100,"level":"INFO"}`)
+	h := l.DebugHandler(adminOnly)
+
+	l.Info("kept")
+	l.Debug("dropped")
+	for i := 0; i < 2; i++ {
+		if code, body := debugRequest(t, h, http.MethodPost, "level?adapter=memory&level=DEBG"); code != http.StatusNoContent {
+			t.Fatalf("set level %d: %d %s", i, code, body)
+		}
+	}
+	l.Debug("shown")
+
+	got := QueryMemory(MemoryQuery{})
+	if len(got) != 2 || got[0].Content != "kept" || got[1].Content != "shown" {
+		t.Fatalf("got %v, want kept and shown", got)
+	}
+	if outputs := l.Outputs(); len(outputs) != 1 || outputs[0].Level != "DEBG" ||
+		!strings.Contains(outputs[0].Config, `"level":"DEBG"`) {
+		t.Fatalf("outputs %+v", outputs)
+	}
+}
+
+func TestDebugHandlerTail(t *testing.T) {
+	l := NewHTLog()
+	l.SetHTLog(AdapterMemory, `{"entries":100}`)
+	h := l.DebugHandler(adminOnly)
+
+	l.Info("hidden user=alice")
+	l.Error("shown user=bob")
+	code, body := debugRequest(t, h, http.MethodGet, "tail?n=10&field=user=bob")
+	if code != http.StatusOK || !strings.Contains(body, "shown user=bob") || strings.Contains(body, "hidden") {
+		t.Fatalf("tail: %d %s", code, body)
+	}
+	l.Close()
+
+	// 没有memory输出
+	other := NewHTLog()
+	defer other.Close()
+	if code, _ := debugRequest(t, other.DebugHandler(adminOnly), http.MethodGet, "tail"); code != http.StatusNotFound {
+		t.Fatalf("tail without memory: got %d, want 404", code)
+	}
+}
+
+func TestDebugHandlerRotate(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "app.log")
+	l := NewHTLog()
+	defer l.Close()
+	h := l.DebugHandler(adminOnly)
+
+	if code, _ := debugRequest(t, h, http.MethodPost, "rotate"); code != http.StatusBadRequest {
+		t.Fatalf("rotate without file: got %d, want 400", code)
+	}
+
+	l.SetHTLog(AdapterFile, `{"filename":"`+fn+`","level":"TRAC"}`)
+	l.Info("before rotate")
+	if code, body := debugRequest(t, h, http.MethodPost, "rotate"); code != http.StatusNoContent {
+		t.Fatalf("rotate: %d %s", code, body)
+	}
+	rotated, _ := filepath.Glob(filepath.Join(dir, "app.*.log"))
+	if len(rotated) != 1 {
+		t.Fatalf("rotated files: %v", rotated)
+	}
+	if _, err := os.Stat(fn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDebugHandlerBadRequests(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.SetHTLog(AdapterMemory, `{"entries":100}`)
+	h := l.DebugHandler(adminOnly)
+
+	for _, c := range []struct {
+		method, target string
+		code           int
+	}{
+		{http.MethodGet, "level?adapter=memory&level=WARN", http.StatusMethodNotAllowed},
+		{http.MethodPost, "outputs", http.StatusMethodNotAllowed},
+		{http.MethodPost, "tail", http.StatusMethodNotAllowed},
+		{http.MethodGet, "rotate", http.StatusMethodNotAllowed},
+		{http.MethodPost, "level?adapter=memory&level=LOUD", http.StatusBadRequest},
+		{http.MethodPost, "level?adapter=conn&level=WARN", http.StatusBadRequest},
+		{http.MethodPost, "level?module=app&level=LOUD", http.StatusBadRequest},
+		{http.MethodPost, "level?level=WARN", http.StatusBadRequest},
+		{http.MethodGet, "nope", http.StatusNotFound},
+	} {
+		if code, body := debugRequest(t, h, c.method, c.target); code != c.code {
+			t.Errorf("%s %s: got %d %s, want %d", c.method, c.target, code, body, c.code)
+		}
+	}
+}
+
+// 调试接口挂在管理路由下，只允许带令牌的请求
+func ExampleLocalHTLog_DebugHandler() {
+	debug_log := NewHTLog()
+	debug_log.SetHTLog(AdapterMemory, `{"entries":100}`)
+	h := debug_log.DebugHandler(func(r *http.Request) bool {
+		return r.Header.Get("X-Admin-Token") == "secret"
+	})
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/debug/log/level?adapter=memory&level=WARN", nil),
+		httptest.NewRequest(http.MethodPost, "/debug/log/level?module=htlog/&level=TRAC", nil),
+	} {
+		req.Header.Set("X-Admin-Token", "secret")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		fmt.Println(req.URL, w.Code)
+	}
+	debug_log.Close()
+	// Output:
+	// /debug/log/level?adapter=memory&level=WARN 204
+	// /debug/log/level?module=htlog/&level=TRAC 204
+}
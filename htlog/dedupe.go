@@ -0,0 +1,105 @@
+package htlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// outputOptions 是所有输出共用的配置项，由LocalHTLog处理，适配器忽略
+type outputOptions struct {
+	Dedupe string `json:"dedupe,omitempty"` // 合并重复日志的时间窗口，比如 "10s"
+}
+
+// 从输出的配置中解析重复日志合并
+func newOutputDedupe(config string, emit func(when time.Time, msg *loginfo, level int)) (*dedupe, error) {
+	var opts outputOptions
+	if err := json.Unmarshal([]byte(config), &opts); err != nil || opts.Dedupe == "" {
+		return nil, nil
+	}
+	window, err := time.ParseDuration(opts.Dedupe)
+	if err != nil {
+		return nil, fmt.Errorf("dedupe %s: %v", opts.Dedupe, err)
+	}
+	if window <= 0 {
+		return nil, nil
+	}
+	return &dedupe{window: window, emit: emit, seen: map[dedupeKey]*dedupeEntry{}}, nil
+}
+
+type dedupeKey struct {
+	level   int
+	path    string
+	content string
+}
+
+type dedupeEntry struct {
+	msg   *loginfo
+	n     int // 合并的条数
+	last  time.Time
+	timer *time.Timer
+}
+
+// dedupe 合并一个输出在时间窗口内相同等级、位置和内容的日志，
+// 第一条立即输出，窗口结束时再输出一条 "(repeated N times)"
+type dedupe struct {
+	window time.Duration
+	emit   func(when time.Time, msg *loginfo, level int)
+
+	mu   sync.Mutex
+	seen map[dedupeKey]*dedupeEntry
+}
+
+// 日志是否输出，重复的只计数
+func (d *dedupe) allow(when time.Time, msg *loginfo, level int) bool {
+	key := dedupeKey{level: level, path: msg.Path, content: msg.Content}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.seen[key]; ok {
+		e.n++
+		e.last = when
+		return false
+	}
+	e := &dedupeEntry{msg: msg, last: when}
+	e.timer = time.AfterFunc(d.window, func() {
+		d.flush(key, e)
+	})
+	d.seen[key] = e
+	return true
+}
+
+// 窗口结束，输出重复的条数
+func (d *dedupe) flush(key dedupeKey, e *dedupeEntry) {
+	d.mu.Lock()
+	if d.seen[key] != e {
+		d.mu.Unlock()
+		return
+	}
+	delete(d.seen, key)
+	d.mu.Unlock()
+	d.report(key, e)
+}
+
+// 输出重复的条数，e已经不在d.seen中
+func (d *dedupe) report(key dedupeKey, e *dedupeEntry) {
+	if e.n == 0 {
+		return
+	}
+	repeated := *e.msg
+	repeated.Content = fmt.Sprintf("%s (repeated %d times)", e.msg.Content, e.n)
+	d.emit(e.last, &repeated, key.level)
+}
+
+// 停止所有窗口，输出还没输出的重复条数
+func (d *dedupe) stop() {
+	d.mu.Lock()
+	seen := d.seen
+	d.seen = map[dedupeKey]*dedupeEntry{}
+	d.mu.Unlock()
+
+	for key, e := range seen {
+		e.timer.Stop()
+		d.report(key, e)
+	}
+}
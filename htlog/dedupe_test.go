@@ -0,0 +1,143 @@
+package htlog
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// 收集dedupe输出的日志
+type dedupeSink struct {
+	mu   sync.Mutex
+	got  []string
+	done chan struct{} // 每输出一条发一个信号
+}
+
+func newDedupeSink() *dedupeSink {
+	return &dedupeSink{done: make(chan struct{}, 100)}
+}
+
+func (s *dedupeSink) emit(when time.Time, msg *loginfo, level int) {
+	s.mu.Lock()
+	s.got = append(s.got, msg.Content)
+	s.mu.Unlock()
+	s.done <- struct{}{}
+}
+
+func (s *dedupeSink) lines() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.got...)
+}
+
+// 窗口结束时由time.AfterFunc输出重复的条数，之后同样的日志开始新的窗口
+func TestDedupeAfterWindow(t *testing.T) {
+	sink := newDedupeSink()
+	d, err := newOutputDedupe(`{"dedupe":"20ms"}`, sink.emit)
+	if err != nil || d == nil {
+		t.Fatalf("got %v %v", d, err)
+	}
+	now := time.Now()
+	boom := &loginfo{Path: "a.go:1", Content: "boom"}
+	if !d.allow(now, boom, LevelError) {
+		t.Fatal("the first message was suppressed")
+	}
+	for i := 0; i < 4; i++ {
+		if d.allow(now, &loginfo{Path: "a.go:1", Content: "boom"}, LevelError) {
+			t.Fatal("a duplicate was allowed")
+		}
+	}
+	// 等级、位置或内容不同的不合并
+	for _, msg := range []*loginfo{{Path: "a.go:2", Content: "boom"}, {Path: "a.go:1", Content: "other"}} {
+		if !d.allow(now, msg, LevelError) {
+			t.Fatalf("%+v was suppressed", msg)
+		}
+	}
+	if !d.allow(now, &loginfo{Path: "a.go:1", Content: "boom"}, LevelWarning) {
+		t.Fatal("another level was suppressed")
+	}
+
+	select {
+	case <-sink.done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the repeated count wasn't written after the window")
+	}
+	if got := sink.lines(); len(got) != 1 || got[0] != "boom (repeated 4 times)" {
+		t.Fatalf("got %v", got)
+	}
+	// 只出现一次的日志不输出重复条数
+	time.Sleep(50 * time.Millisecond)
+	if got := sink.lines(); len(got) != 1 {
+		t.Fatalf("got %v", got)
+	}
+
+	if !d.allow(time.Now(), boom, LevelError) {
+		t.Fatal("a new window didn't start")
+	}
+	d.stop()
+}
+
+// stop立即输出还没结束的窗口，之后过期的定时器不再重复输出
+func TestDedupeStop(t *testing.T) {
+	sink := newDedupeSink()
+	d, _ := newOutputDedupe(`{"dedupe":"10ms"}`, sink.emit)
+	msg := &loginfo{Content: "x"}
+	for i := 0; i < 3; i++ {
+		d.allow(time.Now(), msg, LevelInformational)
+	}
+	d.stop()
+	time.Sleep(50 * time.Millisecond)
+	if got := sink.lines(); len(got) != 1 || got[0] != "x (repeated 2 times)" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestDedupeConfig(t *testing.T) {
+	for _, config := range []string{`{}`, `{"dedupe":""}`, `{"dedupe":"0s"}`, `not json`} {
+		if d, err := newOutputDedupe(config, nil); d != nil || err != nil {
+			t.Errorf("%s: got %v %v, want no dedupe", config, d, err)
+		}
+	}
+	if _, err := newOutputDedupe(`{"dedupe":"x"}`, nil); err == nil {
+		t.Error("a bad window was accepted")
+	}
+}
+
+// 每个输出单独配置，没有配置dedupe的输出保留每一条
+func TestDedupePerOutput(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.Reset()
+	if err := l.SetHTLog(AdapterMemory, `{"entries":100,"dedupe":"1h"}`); err != nil {
+		t.Fatal(err)
+	}
+	sink := newDedupeSink()
+	output := &nameHTLog{name: "sink", HTLog: sinkHTLog{sink}}
+	output.level.Store(int32(LevelTrace))
+	l.lock.Lock()
+	l.outputs = append(l.outputs, output)
+	l.updateLevel()
+	l.lock.Unlock()
+
+	for i := 0; i < 5; i++ {
+		l.Error("boom")
+	}
+	if got := QueryMemory(MemoryQuery{}); len(got) != 1 {
+		t.Fatalf("memory got %v, want 1 entry", got)
+	}
+	if got := sink.lines(); len(got) != 5 {
+		t.Fatalf("the output without dedupe got %d lines, want 5", len(got))
+	}
+}
+
+// 把写入的日志交给dedupeSink的输出
+type sinkHTLog struct {
+	sink *dedupeSink
+}
+
+func (s sinkHTLog) Init(config string) error { return nil }
+func (s sinkHTLog) LogWrite(when time.Time, msg interface{}, level int) error {
+	s.sink.emit(when, &loginfo{Content: "line"}, level)
+	return nil
+}
+func (s sinkHTLog) Destroy() {}
@@ -0,0 +1,165 @@
+package htlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
+)
+
+// LogEvent 是event适配器发布的日志事件
+type LogEvent struct {
+	Time     time.Time
+	Level    string // EMER, EROR, WARN, INFO, DEBG, TRAC
+	LevelNum int    // LevelEmergency ... LevelTrace
+	Path     string
+	Name     string
+	Content  string
+}
+
+var (
+	eventDispatcher   htevent.HTDispatcher
+	eventDispatcherMu sync.Mutex
+)
+
+// SetEventDispatcher 设置event适配器发布日志的事件分发器
+func SetEventDispatcher(d htevent.HTDispatcher) {
+	eventDispatcherMu.Lock()
+	defer eventDispatcherMu.Unlock()
+	eventDispatcher = d
+}
+
+// EventDispatcher 返回event适配器使用的事件分发器，没有设置时创建一个
+func EventDispatcher() htevent.HTDispatcher {
+	eventDispatcherMu.Lock()
+	defer eventDispatcherMu.Unlock()
+	if eventDispatcher == nil {
+		eventDispatcher = htevent.NewHTDispatcher()
+	}
+	return eventDispatcher
+}
+
+// eventHTLog 把日志发布到事件分发器的 <topic>.<LEVEL> 事件，比如 log.EROR，
+// 监听者可以订阅 log.* 接收所有等级。
+// 日志先放入缓冲队列，由单独的go程发布，队列满时丢弃，写日志不会被监听者阻塞。
+type eventHTLog struct {
+	sync.Mutex
+	Topic    string `json:"topic"`
+	Level    string `json:"level"`
+	Buffer   int    `json:"buffer"`
+	LogLevel int    `json:"-"`
+	outputOptions
+
+	queue   chan *LogEvent
+	done    chan struct{}
+	dropped uint64
+}
+
+const (
+	eventDefaultTopic  = "log"
+	eventDefaultBuffer = 1024
+)
+
+// Init event htlog with json config.
+// jsonConfig like:
+//
+//	{
+//	"topic":"log",
+//	"level":"WARN",
+//	"buffer":1024
+//	}
+func (e *eventHTLog) Init(jsonConfig string) error {
+	e.Destroy()
+
+	e.Lock()
+	defer e.Unlock()
+	e.Topic, e.Level, e.Buffer, e.LogLevel = eventDefaultTopic, "", eventDefaultBuffer, LevelTrace
+	if len(jsonConfig) > 0 {
+		err := json.Unmarshal([]byte(jsonConfig), e)
+		if err != nil {
+			return err
+		}
+	}
+	if l, ok := LevelMap[e.Level]; ok {
+		e.LogLevel = l
+	}
+	if e.Topic == "" {
+		e.Topic = eventDefaultTopic
+	}
+	if e.Buffer <= 0 {
+		e.Buffer = eventDefaultBuffer
+	}
+
+	e.queue = make(chan *LogEvent, e.Buffer)
+	e.done = make(chan struct{})
+	go e.publish(e.queue, e.done, e.Topic)
+	return nil
+}
+
+func (e *eventHTLog) LogWrite(when time.Time, msgText interface{}, level int) error {
+	msg, ok := msgText.(*loginfo)
+	if !ok {
+		return nil
+	}
+
+	e.Lock()
+	defer e.Unlock()
+	if e.queue == nil {
+		return nil
+	}
+	ev := &LogEvent{
+		Time:     when,
+		Level:    msg.Level,
+		LevelNum: level,
+		Path:     msg.Path,
+		Name:     msg.Name,
+		Content:  msg.Content,
+	}
+	select {
+	case e.queue <- ev:
+	default:
+		// 队列满时丢弃，不阻塞写日志
+		atomic.AddUint64(&e.dropped, 1)
+	}
+	return nil
+}
+
+// 发布队列中的日志，直到队列关闭
+func (e *eventHTLog) publish(queue chan *LogEvent, done chan struct{}, topic string) {
+	defer close(done)
+	d := EventDispatcher()
+	for ev := range queue {
+		err := d.Handler(topic+"."+ev.Level, *ev)
+		if _, ok := err.(*htevent.HTEventNotDefined); ok || err == nil {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "htlog event %s.%s: %v\n", topic, ev.Level, err)
+	}
+}
+
+func (e *eventHTLog) Destroy() {
+	e.Lock()
+	queue, done := e.queue, e.done
+	e.queue, e.done = nil, nil
+	e.Unlock()
+
+	if queue != nil {
+		close(queue)
+		<-done
+	}
+}
+
+// EventDropped 返回event适配器因队列满丢弃的日志条数
+func EventDropped() uint64 {
+	return atomic.LoadUint64(&eventAdapter.dropped)
+}
+
+var eventAdapter = &eventHTLog{LogLevel: LevelTrace}
+
+func init() {
+	Register(AdapterEvent, eventAdapter)
+}
@@ -0,0 +1,103 @@
+package htlog
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
+)
+
+// 按等级发布到 <topic>.<LEVEL>，低于输出等级的不发布
+func TestEventOutput(t *testing.T) {
+	d := htevent.NewHTDispatcher()
+	SetEventDispatcher(d)
+	var mu sync.Mutex
+	var got []string
+	d.On("app.*", func(name string, e LogEvent) {
+		mu.Lock()
+		got = append(got, name+":"+e.Content)
+		mu.Unlock()
+	})
+	l := NewHTLog()
+	l.Reset()
+	if err := l.SetHTLog(AdapterEvent, `{"topic":"app","level":"WARN"}`); err != nil {
+		t.Fatal(err)
+	}
+	l.Error("boom %d", 1)
+	l.Info("skip")
+	l.Warn("w")
+	l.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0] != "app.EROR:boom 1" || got[1] != "app.WARN:w" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+// 监听者阻塞时队列满了丢弃，不阻塞写日志
+func TestEventOutputDropsWhenFull(t *testing.T) {
+	d := htevent.NewHTDispatcher()
+	SetEventDispatcher(d)
+	block := make(chan struct{})
+	d.On("log.EROR", func(e LogEvent) { <-block })
+	l := NewHTLog()
+	l.Reset()
+	l.SetHTLog(AdapterEvent, `{"buffer":2}`)
+
+	dropped := EventDropped()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			l.Error("x")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("writes blocked on a full queue")
+	}
+	if EventDropped() == dropped {
+		t.Fatal("nothing dropped")
+	}
+	close(block)
+	l.Close()
+}
+
+// 写日志时重新Init没有数据竞争，用 -race 运行
+func TestEventOutputReinit(t *testing.T) {
+	SetEventDispatcher(htevent.NewHTDispatcher())
+	l := NewHTLog()
+	defer l.Close()
+	l.Reset()
+	l.SetHTLog(AdapterEvent, `{"level":"INFO"}`)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				l.Info("x")
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		level := "WARN"
+		if i%2 == 0 {
+			level = "DEBG"
+		}
+		if err := l.SetHTLog(AdapterEvent, `{"level":"`+level+`"}`); err != nil {
+			t.Fatal(err)
+		}
+		l.SetLevel(AdapterEvent, "TRAC")
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -3,6 +3,8 @@ package htlog
 import (
 	"fmt"
 	"os"
+
+	"github.com/hottaro/golang_tiny_lib/htevent"
 )
 
 func HTLog_test() {
@@ -21,6 +23,57 @@ func HTLog_test() {
 	console_log2.SetHTLog("console", `{"level":"EROR"}`)
 	testConsoleCalls(console_log2)
 
+	// event
+	d := htevent.NewHTDispatcher()
+	SetEventDispatcher(d)
+	d.On("log.*", func(name string, e LogEvent) {
+		fmt.Println(name, e.Path, e.Content)
+	})
+	event_log := NewHTLog()
+	event_log.SetHTLog(AdapterEvent, `{"level":"WARN"}`)
+	testConsoleCalls(event_log)
+	event_log.Close()
+
+	// memory
+	memory_log := NewHTLog()
+	memory_log.SetHTLog(AdapterMemory, `{"entries":100}`)
+	memory_log.Warn("login user=%s failed", "bob")
+	for _, e := range QueryMemory(MemoryQuery{Level: "WARN", Fields: map[string]string{"user": "bob"}}) {
+		fmt.Println(e.Time, e.Level, e.Path, e.Content)
+	}
+	memory_log.Close()
+
+	// duplicates
+	dedupe_log := NewHTLog()
+	dedupe_log.SetHTLog(AdapterConsole, `{"level":"TRAC","dedupe":"1s"}`)
+	for i := 0; i < 1000; i++ {
+		dedupe_log.Error("connection refused")
+	}
+	dedupe_log.Close()
+
+	// sampling
+	sampled_log := NewHTLog()
+	sampled_log.SetSampling(&Sampling{
+		Levels:  map[string]*SamplePolicy{"DEBG": {First: 10, Thereafter: 100}},
+		Rate:    1000,
+		Summary: "1s",
+	})
+	for i := 0; i < 10000; i++ {
+		sampled_log.Debug("hot loop %d", i)
+	}
+	sampled_log.Close()
+
+	// redaction
+	redact_log := NewHTLog()
+	redact_log.SetRedaction(&Redaction{
+		Detectors: []string{"password", "token", "card", "email"},
+		Fields:    []string{"session"},
+		Rules:     []RedactRule{{Name: "phone", Pattern: `(1[3-9]\d)\d{4}(\d{4})`, Replace: "$1****$2"}},
+	})
+	redact_log.Info("login user=%s password=%s session=%s phone=%s", "bob@example.com", "123456", "abcd", "13812345678")
+	redact_log.Info(`pay {"card":"4111 1111 1111 1111","token":"xyz"}`)
+	redact_log.Close()
+
 	// file
 	file_log := NewHTLog()
 	file_log.SetHTLog(AdapterFile, `{"filename":"test.log",
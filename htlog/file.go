@@ -8,10 +8,13 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/hottaro/golang_tiny_lib/htfile"
 )
 
 type fileHTLog struct {
@@ -24,8 +27,13 @@ type fileHTLog struct {
 	MaxSize    int    `json:"maxsize"`
 	Daily      bool   `json:"daily"`
 	MaxDays    int64  `json:"maxdays"`
+	MaxFiles   int    `json:"maxfiles"`
+	MaxBytes   int64  `json:"maxbytes"`
+	Compress   bool   `json:"compress"`
+	ArchiveDir string `json:"archivedir"`
 	Level      string `json:"level"`
 	PermitMask string `json:"permit"`
+	outputOptions
 
 	LogLevel             int
 	maxSizeCurSize       int
@@ -33,6 +41,7 @@ type fileHTLog struct {
 	dailyOpenDate        int
 	dailyOpenTime        time.Time
 	fileNameOnly, suffix string
+	retention            *htfile.Retention
 }
 
 // Init file htlog with json config.
@@ -43,6 +52,10 @@ type fileHTLog struct {
 //	"maxsize":1024,
 //	"daily":true,
 //	"maxdays":15,
+//	"maxfiles":30,
+//	"maxbytes":1073741824,
+//	"compress":true,
+//	"archivedir":"log/archive",
 //	"rotate":true,
 //  	"permit":"0600"
 //	}
@@ -51,6 +64,8 @@ func (f *fileHTLog) Init(jsonConfig string) error {
 	if len(jsonConfig) == 0 {
 		return nil
 	}
+	// 适配器是单例，重新Init时不沿用上一次的配置
+	f.setDefaults()
 	err := json.Unmarshal([]byte(jsonConfig), f)
 	if err != nil {
 		return err
@@ -67,10 +82,37 @@ func (f *fileHTLog) Init(jsonConfig string) error {
 	if l, ok := LevelMap[f.Level]; ok {
 		f.LogLevel = l
 	}
+	f.retention = f.newRetention()
 	err = f.newFile()
 	return err
 }
 
+// 配置项的默认值
+func (f *fileHTLog) setDefaults() {
+	f.Filename, f.Level, f.ArchiveDir = "", "", ""
+	f.Daily, f.MaxDays, f.Append = true, 7, true
+	f.LogLevel, f.PermitMask = LevelDebug, "0777"
+	f.MaxLines, f.MaxSize = 10, 10*1024*1024
+	f.MaxFiles, f.MaxBytes, f.Compress = 0, 0, false
+	f.outputOptions = outputOptions{}
+}
+
+// 旧日志的清理、压缩和归档与htfile共用同一套保留策略
+func (f *fileHTLog) newRetention() *htfile.Retention {
+	r := &htfile.Retention{
+		MaxFiles: f.MaxFiles,
+		MaxBytes: f.MaxBytes,
+		Compress: f.Compress,
+	}
+	if f.MaxDays > 0 {
+		r.MaxAge = 24 * time.Hour * time.Duration(f.MaxDays)
+	}
+	if f.ArchiveDir != "" {
+		r.Archiver = &htfile.DirArchiver{Dir: f.ArchiveDir}
+	}
+	return r
+}
+
 func (f *fileHTLog) needCreateFresh(size int, day int) bool {
 	return (f.MaxLines > 0 && f.maxLinesCurLines >= f.MaxLines) ||
 		(f.MaxSize > 0 && f.maxSizeCurSize+size >= f.MaxSize) ||
@@ -84,10 +126,6 @@ func (f *fileHTLog) LogWrite(when time.Time, msgText interface{}, level int) err
 	if !ok {
 		return nil
 	}
-	if level > f.LogLevel {
-		return nil
-	}
-
 	day := when.Day()
 	msg += "\n"
 	if f.Append {
@@ -191,6 +229,7 @@ func (f *fileHTLog) createFreshFile(logTime time.Time) error {
 	// Find the next available number
 	num := 1
 	fName := ""
+	closed := ""
 	rotatePerm, err := strconv.ParseInt(f.PermitMask, 8, 64)
 	if err != nil {
 		return err
@@ -205,12 +244,12 @@ func (f *fileHTLog) createFreshFile(logTime time.Time) error {
 	if f.dailyOpenDate != logTime.Day() {
 		for ; err == nil && num <= 999; num++ {
 			fName = f.fileNameOnly + fmt.Sprintf(".%s.%03d%s", f.dailyOpenTime.Format("2006-01-02"), num, f.suffix)
-			_, err = os.Lstat(fName)
+			err = f.rotatedExists(fName)
 		}
 	} else { //如果仅仅是文件大小或行数达到了限制，仅仅变更后缀序号即可
 		for ; err == nil && num <= 999; num++ {
 			fName = f.fileNameOnly + fmt.Sprintf(".%s.%03d%s", logTime.Format("2006-01-02"), num, f.suffix)
-			_, err = os.Lstat(fName)
+			err = f.rotatedExists(fName)
 		}
 	}
 
@@ -231,11 +270,12 @@ func (f *fileHTLog) createFreshFile(logTime time.Time) error {
 	}
 
 	err = os.Chmod(fName, os.FileMode(rotatePerm))
+	closed = fName
 
 RESTART_htlog:
 
 	startHTLogErr := f.newFile()
-	go f.deleteOldLog()
+	go deleteOldLog(closed, f.fileNameOnly+".*"+f.suffix+"*", f.Filename, f.retention, f.rotatedMatcher())
 
 	if startHTLogErr != nil {
 		return fmt.Errorf("Rotate StartHTLog: %s", startHTLogErr)
@@ -246,27 +286,45 @@ RESTART_htlog:
 	return nil
 }
 
-func (f *fileHTLog) deleteOldLog() {
-	dir := filepath.Dir(f.Filename)
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) (returnErr error) {
-		defer func() {
-			if r := recover(); r != nil {
-				fmt.Fprintf(os.Stderr, "Unable to delete old log '%s', error: %v\n", path, r)
-			}
-		}()
+// Rotate 立即轮转日志文件
+func (f *fileHTLog) Rotate() error {
+	f.Lock()
+	defer f.Unlock()
+	if f.fileWriter == nil {
+		return errors.New("log file is not open")
+	}
+	return f.createFreshFile(time.Now())
+}
 
-		if info == nil {
-			return
+// 轮转文件可能已被压缩为.gz或移动到归档目录，都不存在时序号才可用
+func (f *fileHTLog) rotatedExists(name string) error {
+	names := []string{name, name + ".gz"}
+	if f.ArchiveDir != "" {
+		archived := filepath.Join(f.ArchiveDir, filepath.Base(name))
+		names = append(names, archived, archived+".gz")
+	}
+	var err error
+	for _, n := range names {
+		if _, err = os.Lstat(n); err == nil {
+			return nil
 		}
+	}
+	return err
+}
 
-		if f.MaxDays != -1 && !info.IsDir() && info.ModTime().Add(24*time.Hour*time.Duration(f.MaxDays)).Before(time.Now()) {
-			if strings.HasPrefix(filepath.Base(path), filepath.Base(f.fileNameOnly)) &&
-				strings.HasSuffix(filepath.Base(path), f.suffix) {
-				os.Remove(path)
-			}
-		}
-		return
-	})
+// 只接受轮转生成的文件名 name.2006-01-02.001.log，以及压缩后的.gz
+func (f *fileHTLog) rotatedMatcher() func(name string) bool {
+	re := regexp.MustCompile(`^` + regexp.QuoteMeta(filepath.Base(f.fileNameOnly)) +
+		`\.\d{4}-\d{2}-\d{2}\.\d{3,}` + regexp.QuoteMeta(f.suffix) + `(\.gz)?$`)
+	return re.MatchString
+}
+
+// 处理刚轮转出来的文件closed，并按保留策略清理旧日志，
+// 参数在轮转时取好，适配器重新Init时不影响后台的清理
+func deleteOldLog(closed, pattern, active string, retention *htfile.Retention, match func(name string) bool) {
+	if err := retention.Run(closed, pattern, active, match); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to delete old log '%s', error: %v\n", active, err)
+	}
 }
 
 func (f *fileHTLog) Destroy() {
@@ -274,13 +332,7 @@ func (f *fileHTLog) Destroy() {
 }
 
 func init() {
-	Register(AdapterFile, &fileHTLog{
-		Daily:      true,
-		MaxDays:    7,
-		Append:     true,
-		LogLevel:   LevelDebug,
-		PermitMask: "0777",
-		MaxLines:   10,
-		MaxSize:    10 * 1024 * 1024,
-	})
+	f := &fileHTLog{}
+	f.setDefaults()
+	Register(AdapterFile, f)
 }
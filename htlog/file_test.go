@@ -0,0 +1,84 @@
+package htlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 移动到archivedir的轮转文件保留各自的序号
+func TestRotateToArchiveDir(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "archive")
+	l := NewHTLog()
+	l.Reset()
+	err := l.SetHTLog(AdapterFile, `{"filename":"`+filepath.Join(dir, "app.log")+`","level":"TRAC",
+		"permit":"0644","maxlines":0,"archivedir":"`+archive+`"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		l.Info("line %d", i)
+		if err := l.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// 每次轮转后在后台归档
+	var files []string
+	for i := 0; i < 100; i++ {
+		files, _ = filepath.Glob(filepath.Join(archive, "app.*.log"))
+		if len(files) == 3 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(files) != 3 {
+		t.Fatal(files)
+	}
+	for _, f := range files {
+		if b, _ := os.ReadFile(f); len(b) == 0 {
+			t.Errorf("%s is empty", f)
+		}
+	}
+}
+
+// 按maxfiles清理时只删除轮转生成的文件
+func TestRetentionKeepsOtherLogs(t *testing.T) {
+	dir := t.TempDir()
+	others := []string{"app.backup.log", "app.2024.log", "app.conf.log.gz"}
+	for _, name := range others {
+		os.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+	}
+	l := NewHTLog()
+	l.Reset()
+	err := l.SetHTLog(AdapterFile, `{"filename":"`+filepath.Join(dir, "app.log")+`","level":"TRAC",
+		"permit":"0644","maxlines":0,"maxfiles":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		l.Info("line %d", i)
+		l.Rotate()
+	}
+	l.Close()
+
+	var rotated []string
+	for i := 0; i < 100; i++ {
+		rotated, _ = filepath.Glob(filepath.Join(dir, "app.????-??-??.*.log"))
+		if len(rotated) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(rotated) != 1 {
+		t.Fatalf("rotated files left: %v", rotated)
+	}
+	for _, name := range others {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s was deleted", name)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -52,6 +53,8 @@ const (
 	AdapterConsole       = "console"             // 控制台输出配置项
 	AdapterFile          = "file"                // 文件输出配置项
 	AdapterConn          = "conn"                // 网络输出配置项
+	AdapterEvent         = "event"               // 事件分发输出配置项
+	AdapterMemory        = "memory"              // 内存缓冲输出配置项
 )
 
 // log provider interface
@@ -84,6 +87,26 @@ type nameHTLog struct {
 	HTLog
 	name   string
 	config string
+	level  atomic.Int32 // 输出的等级，写入前过滤，可以用SetLevel修改
+	dedupe *dedupe      // 重复日志合并，没有配置时为nil
+}
+
+// 销毁输出，先输出还没输出的重复条数
+func (l *nameHTLog) destroy() {
+	l.stopDedupe()
+	l.HTLog.Destroy()
+}
+
+// 输出还没输出的重复条数
+func (l *nameHTLog) stopDedupe() {
+	if l.dedupe != nil {
+		l.dedupe.stop()
+	}
+}
+
+// reinitHTLog 是重新设置配置时保留状态的适配器，比如memory保留缓冲中的日志
+type reinitHTLog interface {
+	reinit(config string) error
 }
 
 type LocalHTLog struct {
@@ -94,6 +117,12 @@ type LocalHTLog struct {
 	callDepth  int
 	timeFormat string
 	usePath    string
+	modLock    sync.RWMutex
+	modules    map[string]int // 模块日志等级
+	sampler    atomic.Pointer[sampler]
+	redactor   atomic.Pointer[redactor]
+	level      atomic.Int32                 // 输出中最低的优先级，没有输出接受的日志不采样
+	written    atomic.Pointer[[]*nameHTLog] // 写日志用的outputs快照，写入时不加锁
 }
 
 func NewHTLog(depth ...int) *LocalHTLog {
@@ -118,6 +147,10 @@ type logConfig struct {
 	Console    *consoleHTLog `json:"Console,omitempty"`
 	File       *fileHTLog    `json:"File,omitempty"`
 	Conn       *connHTLog    `json:"Conn,omitempty"`
+	Event      *eventHTLog   `json:"Event,omitempty"`
+	Memory     *memoryHTLog  `json:"Memory,omitempty"`
+	Sampling   *Sampling     `json:"Sampling,omitempty"`
+	Redaction  *Redaction    `json:"Redaction,omitempty"`
 }
 
 func init() {
@@ -143,27 +176,51 @@ func (this *LocalHTLog) SetHTLog(adapterName string, configs ...string) error {
 				//配置没有变动，不重新设置
 				return fmt.Errorf("you have set same config for this adaptername %s", adapterName)
 			}
-			l.HTLog.Destroy()
 			num = i
 			break
 		}
 	}
+	// 保留状态的适配器用新配置重新初始化，其他的先销毁
+	reinit, keep := adapters[adapterName].(reinitHTLog)
+	if num >= 0 {
+		if keep {
+			this.outputs[num].stopDedupe()
+		} else {
+			this.outputs[num].destroy()
+		}
+	}
 	htlog, ok := adapters[adapterName]
+	var err error
 	if !ok {
 		return fmt.Errorf("unknown adaptername %s (forgotten Register?)", adapterName)
 	}
 
-	err := htlog.Init(config)
+	output := &nameHTLog{name: adapterName, HTLog: htlog, config: config}
+	output.dedupe, err = newOutputDedupe(config, func(when time.Time, msg *loginfo, level int) {
+		this.writeToHTLog(output, when, msg, level)
+	})
+	if err == nil {
+		if num >= 0 && keep {
+			err = reinit.reinit(config)
+		} else {
+			err = htlog.Init(config)
+		}
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "htlog Init <%s> err:%v, %s output ignore!\n",
 			adapterName, err, adapterName)
 		return err
 	}
+	output.level.Store(int32(outputLevel(htlog)))
 	if num >= 0 {
-		this.outputs[i] = &nameHTLog{name: adapterName, HTLog: htlog, config: config}
-		return nil
+		// 写日志可能正在遍历旧快照，替换时复制一份
+		outputs := append([]*nameHTLog(nil), this.outputs...)
+		outputs[i] = output
+		this.outputs = outputs
+	} else {
+		this.outputs = append(this.outputs, output)
 	}
-	this.outputs = append(this.outputs, &nameHTLog{name: adapterName, HTLog: htlog, config: config})
+	this.updateLevel()
 	return nil
 }
 
@@ -173,7 +230,7 @@ func (this *LocalHTLog) DelHTLog(adapterName string) error {
 	outputs := []*nameHTLog{}
 	for _, lg := range this.outputs {
 		if lg.name == adapterName {
-			lg.Destroy()
+			lg.destroy()
 		} else {
 			outputs = append(outputs, lg)
 		}
@@ -182,30 +239,59 @@ func (this *LocalHTLog) DelHTLog(adapterName string) error {
 		return fmt.Errorf("logs: unknown adaptername %s (forgotten Register?)", adapterName)
 	}
 	this.outputs = outputs
+	this.updateLevel()
 	return nil
 }
 
+// 更新输出中最低的优先级并发布outputs快照，需要this.lock
+func (this *LocalHTLog) updateLevel() {
+	level := -1
+	for _, l := range this.outputs {
+		level = max(level, int(l.level.Load()))
+	}
+	this.level.Store(int32(level))
+	outputs := this.outputs[:len(this.outputs):len(this.outputs)]
+	this.written.Store(&outputs)
+}
+
 // 设置日志起始路径
 func (this *LocalHTLog) SetLogPathTrim(trimPath string) {
 	this.usePath = trimPath
 }
 
 func (this *LocalHTLog) writeToHTLogs(when time.Time, msg *loginfo, level int) {
-	for _, l := range this.outputs {
-		if l.name == AdapterConn {
-			//网络日志，使用json格式发送,此处使用结构体，用于类似ElasticSearch功能检索
-			err := l.LogWrite(when, msg, level)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "unable to WriteMsg to adapter:%v,error:%v\n", l.name, err)
-			}
+	outputs := this.written.Load()
+	if outputs == nil {
+		return
+	}
+	for _, l := range *outputs {
+		if level > int(l.level.Load()) {
 			continue
 		}
+		if l.dedupe != nil && !l.dedupe.allow(when, msg, level) {
+			continue
+		}
+		this.writeToHTLog(l, when, msg, level)
+	}
+}
 
-		msgStr := when.Format(this.timeFormat) + " [" + msg.Level + "] " + "[" + msg.Path + "] " + msg.Content
-		err := l.LogWrite(when, msgStr, level)
+// 写入一个输出
+func (this *LocalHTLog) writeToHTLog(l *nameHTLog, when time.Time, msg *loginfo, level int) {
+	if l.name == AdapterConn || l.name == AdapterEvent || l.name == AdapterMemory {
+		//网络日志，使用json格式发送,此处使用结构体，用于类似ElasticSearch功能检索
+		//事件日志，以结构体发布给监听者
+		//内存日志，保留结构体用于查询
+		err := l.LogWrite(when, msg, level)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "unable to WriteMsg to adapter:%v,error:%v\n", l.name, err)
 		}
+		return
+	}
+
+	msgStr := when.Format(this.timeFormat) + " [" + msg.Level + "] " + "[" + msg.Path + "] " + msg.Content
+	err := l.LogWrite(when, msgStr, level)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to WriteMsg to adapter:%v,error:%v\n", l.name, err)
 	}
 }
 
@@ -229,6 +315,20 @@ func (this *LocalHTLog) writeMsg(logLevel int, msg string, v ...interface{}) err
 		src = strings.Replace(
 			fmt.Sprintf("%s:%d", stringTrim(file, strim), lineno), "%2e", ".", -1)
 	}
+	if !this.moduleEnabled(src, logLevel) {
+		return nil
+	}
+	// 没有输出接受的日志不计入采样和限流
+	if logLevel > int(this.level.Load()) {
+		return nil
+	}
+	if sp := this.sampler.Load(); sp != nil && !sp.allow(src, logLevel, when) {
+		return nil
+	}
+	// 脱敏后再交给输出
+	if r := this.redactor.Load(); r != nil {
+		msg = r.redact(msg)
+	}
 
 	msgSt.Level = levelPrefix[logLevel]
 	msgSt.Path = src
@@ -247,7 +347,12 @@ func (this *LocalHTLog) Fatal(format string, args ...interface{}) {
 
 func (this *LocalHTLog) Panic(format string, args ...interface{}) {
 	this.Emer("###Exec Panic:"+format, args...)
-	panic(fmt.Sprintf(format, args...))
+	// panic的内容可能被recover后再输出，同样脱敏
+	msg := fmt.Sprintf(format, args...)
+	if r := this.redactor.Load(); r != nil {
+		msg = r.redact(msg)
+	}
+	panic(msg)
 }
 
 // Emer Log EMERGENCY level message.
@@ -281,19 +386,28 @@ func (this *LocalHTLog) Trace(format string, v ...interface{}) {
 }
 
 func (this *LocalHTLog) Close() {
+	// 输出还没汇总的丢弃条数
+	if sp := this.sampler.Load(); sp != nil {
+		sp.stop()
+	}
 
+	this.lock.Lock()
+	defer this.lock.Unlock()
 	for _, l := range this.outputs {
-		l.Destroy()
+		l.destroy()
 	}
 	this.outputs = nil
-
+	this.updateLevel()
 }
 
 func (this *LocalHTLog) Reset() {
+	this.lock.Lock()
+	defer this.lock.Unlock()
 	for _, l := range this.outputs {
-		l.Destroy()
+		l.destroy()
 	}
 	this.outputs = nil
+	this.updateLevel()
 }
 
 func (this *LocalHTLog) SetCallDepth(depth int) {
@@ -350,6 +464,11 @@ func SetHTLog(param ...string) error {
 	if conf.TimeFormat != "" {
 		defaultHTLog.timeFormat = conf.TimeFormat
 	}
+	if conf.Redaction != nil {
+		if err := defaultHTLog.SetRedaction(conf.Redaction); err != nil {
+			fmt.Fprintf(os.Stderr, "htlog Redaction err:%v\n", err)
+		}
+	}
 	if conf.Console != nil {
 		console, _ := json.Marshal(conf.Console)
 		defaultHTLog.SetHTLog(AdapterConsole, string(console))
@@ -363,6 +482,19 @@ func SetHTLog(param ...string) error {
 		conn, _ := json.Marshal(conf.Conn)
 		defaultHTLog.SetHTLog(AdapterConn, string(conn))
 	}
+	if conf.Event != nil {
+		event, _ := json.Marshal(conf.Event)
+		defaultHTLog.SetHTLog(AdapterEvent, string(event))
+	}
+	if conf.Memory != nil {
+		memory, _ := json.Marshal(conf.Memory)
+		defaultHTLog.SetHTLog(AdapterMemory, string(memory))
+	}
+	if conf.Sampling != nil {
+		if err := defaultHTLog.SetSampling(conf.Sampling); err != nil {
+			fmt.Fprintf(os.Stderr, "htlog Sampling err:%v\n", err)
+		}
+	}
 	return nil
 }
 
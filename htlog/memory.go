@@ -0,0 +1,270 @@
+package htlog
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryHTLog 在内存环形缓冲中保留最近的日志，用Query查询。
+// 写入时按条数和内容字节数淘汰最旧的日志，缓冲按需增长，不预先分配。
+type memoryHTLog struct {
+	Level    string `json:"level"`
+	Entries  int    `json:"entries"` // 最多保留条数
+	Bytes    int    `json:"bytes"`   // 最多保留内容字节数，0不限制
+	LogLevel int    `json:"-"`
+	outputOptions
+
+	ring atomic.Pointer[memoryRing]
+}
+
+// memoryRing 用一个互斥锁保护，不是无锁的：按字节数淘汰时一次写入要淘汰的条数不定，
+// head，count和size需要一起修改，无锁实现要用复杂的CAS重试。锁只在移动几个指针时持有，
+// 不做IO，和同一条日志写文件或网络的开销相比可以忽略
+type memoryRing struct {
+	mu         sync.Mutex
+	buf        []*LogEvent // 环形，head是最旧的
+	head       int
+	count      int
+	size       int // 保留的内容字节数
+	maxEntries int // 0不限制
+	maxBytes   int // 0不限制
+}
+
+const (
+	memoryDefaultEntries = 1000
+	memoryMinSlots       = 16 // 缓冲增长的起始大小
+)
+
+// Init memory htlog with json config.
+// jsonConfig like:
+//
+//	{
+//	"level":"TRAC",
+//	"entries":1000,
+//	"bytes":1048576
+//	}
+//
+// 只设置bytes时条数不限制
+func (m *memoryHTLog) Init(jsonConfig string) error {
+	r, err := m.parse(jsonConfig)
+	if err != nil {
+		return err
+	}
+	m.ring.Store(r)
+	return nil
+}
+
+// 用新配置重新初始化，保留缓冲中的日志，超过新限制的从最旧的淘汰
+func (m *memoryHTLog) reinit(jsonConfig string) error {
+	r, err := m.parse(jsonConfig)
+	if err != nil {
+		return err
+	}
+	old := m.ring.Load()
+	if old == nil {
+		m.ring.Store(r)
+		return nil
+	}
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	for i := 0; i < old.count; i++ {
+		r.push(old.buf[(old.head+i)%len(old.buf)])
+	}
+	m.ring.Store(r)
+	return nil
+}
+
+// 解析配置，返回新的缓冲
+func (m *memoryHTLog) parse(jsonConfig string) (*memoryRing, error) {
+	m.Level, m.Entries, m.Bytes, m.LogLevel = "", 0, 0, LevelTrace
+	if len(jsonConfig) > 0 {
+		err := json.Unmarshal([]byte(jsonConfig), m)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l, ok := LevelMap[m.Level]; ok {
+		m.LogLevel = l
+	}
+
+	n := max(m.Entries, 0)
+	if n == 0 && m.Bytes <= 0 {
+		n = memoryDefaultEntries
+	}
+	return &memoryRing{
+		maxEntries: n,
+		maxBytes:   max(m.Bytes, 0),
+	}, nil
+}
+
+func (m *memoryHTLog) LogWrite(when time.Time, msgText interface{}, level int) error {
+	r := m.ring.Load()
+	if r == nil {
+		return nil
+	}
+	msg, ok := msgText.(*loginfo)
+	if !ok {
+		return nil
+	}
+	r.push(&LogEvent{
+		Time:     when,
+		Level:    msg.Level,
+		LevelNum: level,
+		Path:     msg.Path,
+		Name:     msg.Name,
+		Content:  msg.Content,
+	})
+	return nil
+}
+
+func (m *memoryHTLog) Destroy() {
+	m.ring.Store(nil)
+}
+
+// 加入一条日志，先淘汰最旧的直到条数和字节数都有空间。
+// 内容超过字节数限制的日志不保留
+func (r *memoryRing) push(e *LogEvent) {
+	n := len(e.Content)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxBytes > 0 && n > r.maxBytes {
+		return
+	}
+	for r.count > 0 && ((r.maxEntries > 0 && r.count >= r.maxEntries) ||
+		(r.maxBytes > 0 && r.size+n > r.maxBytes)) {
+		old := r.buf[r.head]
+		r.buf[r.head] = nil
+		r.head = (r.head + 1) % len(r.buf)
+		r.count--
+		r.size -= len(old.Content)
+	}
+	if r.count == len(r.buf) {
+		r.grow()
+	}
+	r.buf[(r.head+r.count)%len(r.buf)] = e
+	r.count++
+	r.size += n
+}
+
+// 缓冲加倍，不超过条数限制
+func (r *memoryRing) grow() {
+	size := max(2*len(r.buf), memoryMinSlots)
+	if r.maxEntries > 0 {
+		size = min(size, r.maxEntries)
+	}
+	buf := make([]*LogEvent, size)
+	for i := 0; i < r.count; i++ {
+		buf[i] = r.buf[(r.head+i)%len(r.buf)]
+	}
+	r.buf, r.head = buf, 0
+}
+
+// 返回缓冲中的日志，从旧到新
+func (r *memoryRing) entries() []LogEvent {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found := make([]LogEvent, 0, r.count)
+	for i := 0; i < r.count; i++ {
+		found = append(found, *r.buf[(r.head+i)%len(r.buf)])
+	}
+	return found
+}
+
+// MemoryQuery 是memory适配器的查询条件，零值不过滤
+type MemoryQuery struct {
+	Level  string            // 这个等级及更高优先级的日志，比如WARN包括EMER，EROR，WARN
+	Since  time.Time         // 不早于
+	Until  time.Time         // 不晚于
+	Path   string            // 调用位置包含的子串
+	Fields map[string]string // 内容中的 key=value 字段
+	Limit  int               // 最多返回最新的条数
+}
+
+func (q *MemoryQuery) match(e *LogEvent) bool {
+	if l, ok := LevelMap[q.Level]; ok && e.LevelNum > l {
+		return false
+	}
+	if !q.Since.IsZero() && e.Time.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && e.Time.After(q.Until) {
+		return false
+	}
+	if q.Path != "" && !strings.Contains(e.Path, q.Path) {
+		return false
+	}
+	if len(q.Fields) > 0 {
+		fields := e.Fields()
+		for k, v := range q.Fields {
+			if fv, ok := fields[k]; !ok || fv != v {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// QueryMemory 返回memory适配器中符合条件的日志，从旧到新。
+// 没有配置memory适配器时返回nil
+func QueryMemory(q MemoryQuery) []LogEvent {
+	r := memoryAdapter.ring.Load()
+	if r == nil {
+		return nil
+	}
+	var found []LogEvent
+	for _, e := range r.entries() {
+		if q.match(&e) {
+			found = append(found, e)
+		}
+	}
+	if q.Limit > 0 && len(found) > q.Limit {
+		found = found[len(found)-q.Limit:]
+	}
+	return found
+}
+
+// Fields 解析日志内容中的 key=value 字段，值可以用双引号包含空格，比如
+// Info("login user=%s ip=%s msg=%q", ...)
+func (e *LogEvent) Fields() map[string]string {
+	fields := map[string]string{}
+	s := e.Content
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " \t")
+		eq := strings.IndexByte(s, '=')
+		sp := strings.IndexAny(s, " \t")
+		if eq <= 0 || (sp >= 0 && sp < eq) {
+			// 不是字段，跳过这个词
+			if sp < 0 {
+				break
+			}
+			s = s[sp:]
+			continue
+		}
+		key, rest := s[:eq], s[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if sp := strings.IndexAny(rest, " \t"); sp >= 0 {
+			value, rest = rest[:sp], rest[sp:]
+		} else {
+			value, rest = rest, ""
+		}
+		fields[key] = value
+		s = rest
+	}
+	return fields
+}
+
+var memoryAdapter = &memoryHTLog{LogLevel: LevelTrace}
+
+func init() {
+	Register(AdapterMemory, memoryAdapter)
+}
@@ -0,0 +1,89 @@
+package htlog
+
+import (
+	"strings"
+	"testing"
+)
+
+// 字节数限制在写入时淘汰最旧的日志
+func TestMemoryBytesEvictOnWrite(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.Reset()
+	if err := l.SetHTLog(AdapterMemory, `{"bytes":100}`); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		l.Info("%010d", i)
+	}
+
+	r := memoryAdapter.ring.Load()
+	r.mu.Lock()
+	size, count, slots := r.size, r.count, len(r.buf)
+	r.mu.Unlock()
+	if size != 100 || count != 10 {
+		t.Fatalf("size %d count %d, want 100 10", size, count)
+	}
+	// 缓冲按保留的条数增长，不按固定大小分配
+	if slots > 2*memoryMinSlots {
+		t.Fatalf("%d slots for 10 entries", slots)
+	}
+
+	got := QueryMemory(MemoryQuery{})
+	if len(got) != 10 || got[0].Content != "0000000990" || got[9].Content != "0000000999" {
+		t.Fatalf("got %v", got)
+	}
+
+	// 超过限制的日志不保留，也不淘汰已有的
+	l.Info(strings.Repeat("x", 101))
+	if got := QueryMemory(MemoryQuery{}); len(got) != 10 {
+		t.Fatalf("got %d entries after an oversized one", len(got))
+	}
+}
+
+// 条数和字节数同时限制时先达到的生效
+func TestMemoryEntriesAndBytes(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.Reset()
+	l.SetHTLog(AdapterMemory, `{"entries":3,"bytes":1000}`)
+	for i := 0; i < 5; i++ {
+		l.Info("n=%d", i)
+	}
+	got := QueryMemory(MemoryQuery{})
+	if len(got) != 3 || got[0].Content != "n=2" || got[2].Content != "n=4" {
+		t.Fatalf("got %v", got)
+	}
+
+	l.Info(strings.Repeat("y", 600))
+	l.Info(strings.Repeat("z", 600))
+	got = QueryMemory(MemoryQuery{})
+	if len(got) != 1 || got[0].Content[0] != 'z' {
+		t.Fatalf("got %d entries, want the last one", len(got))
+	}
+}
+
+// 修改配置重新初始化时保留缓冲中的日志，删除输出后不再保留
+func TestMemoryKeptOnReinit(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.Reset()
+	l.SetHTLog(AdapterMemory, `{"entries":10}`)
+	for i := 0; i < 3; i++ {
+		l.Info("n=%d", i)
+	}
+	if err := l.SetHTLog(AdapterMemory, `{"entries":2,"level":"INFO"}`); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("n=3")
+	got := QueryMemory(MemoryQuery{})
+	if len(got) != 2 || got[0].Content != "n=2" || got[1].Content != "n=3" {
+		t.Fatalf("got %v, want n=2 n=3", got)
+	}
+
+	l.DelHTLog(AdapterMemory)
+	l.SetHTLog(AdapterMemory, `{"entries":2}`)
+	if got := QueryMemory(MemoryQuery{}); len(got) != 0 {
+		t.Fatalf("got %v after removing the output", got)
+	}
+}
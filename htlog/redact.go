@@ -0,0 +1,196 @@
+package htlog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Redaction 是日志内容的脱敏配置，在所有输出之前执行
+//
+//	{
+//	"detectors": ["password", "token", "card", "email"],
+//	"fields": ["session", "id_card"],
+//	"rules": [{"name": "phone", "pattern": "1[3-9]\\d{9}"}],
+//	"marker": "[REDACTED:{name}]"
+//	}
+type Redaction struct {
+	Detectors []string     `json:"detectors"` // 内置检测，见redactDetectors
+	Fields    []string     `json:"fields"`    // 字段名，隐藏 key=value，key: value，"key":"value" 的值，不区分大小写
+	Rules     []RedactRule `json:"rules"`     // 自定义正则
+	Marker    string       `json:"marker"`    // 替换标记，{name} 替换为检测、字段或规则名
+}
+
+// RedactRule 是自定义的脱敏正则
+type RedactRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"` // 替换文本，可以用 $1 引用分组，为空时替换为标记
+}
+
+const redactMarkerDefault = "[REDACTED:{name}]"
+
+// 密码类的字段名
+var passwordFields = []string{"password", "passwd", "pwd", "secret", "passphrase"}
+
+// 内置检测
+var redactDetectors = map[string]func() []*redactRule{
+	"password": func() []*redactRule {
+		return []*redactRule{fieldRule("password", passwordFields)}
+	},
+	"token": func() []*redactRule {
+		return []*redactRule{
+			{name: "token", re: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`), groups: []int{1}},
+			{name: "token", re: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`)},
+			fieldRule("token", []string{"token", "access_token", "refresh_token", "api_key", "apikey"}),
+		}
+	},
+	"card": func() []*redactRule {
+		return []*redactRule{
+			{name: "card", re: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), valid: luhn},
+		}
+	},
+	"email": func() []*redactRule {
+		return []*redactRule{
+			{name: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+		}
+	},
+}
+
+type redactRule struct {
+	name    string
+	re      *regexp.Regexp
+	groups  []int             // 只替换第一个匹配到的分组，为空时替换整个匹配
+	valid   func(string) bool // 确认匹配是要隐藏的内容
+	replace string
+	marker  string
+}
+
+// 隐藏字段names的值的规则
+func fieldRule(name string, names []string) *redactRule {
+	quoted := make([]string, 0, len(names))
+	for _, n := range names {
+		quoted = append(quoted, regexp.QuoteMeta(n))
+	}
+	return &redactRule{
+		name:   name,
+		re:     regexp.MustCompile(`(?i)"?\b(?:` + strings.Join(quoted, "|") + `)\b"?\s*[=:]\s*(?:"([^"]*)"|([^\s,;&"}]+))`),
+		groups: []int{1, 2},
+	}
+}
+
+func (r *redactRule) apply(s string) string {
+	if r.replace != "" {
+		return r.re.ReplaceAllString(s, r.replace)
+	}
+	matches := r.re.FindAllStringSubmatchIndex(s, -1)
+	if matches == nil {
+		return s
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		for _, g := range r.groups {
+			if m[2*g] >= 0 {
+				start, end = m[2*g], m[2*g+1]
+				break
+			}
+		}
+		if r.valid != nil && !r.valid(s[start:end]) {
+			continue
+		}
+		b.WriteString(s[last:start])
+		b.WriteString(r.marker)
+		last = end
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// 卡号的Luhn校验
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
+
+// redactor 按顺序执行字段、内置检测和自定义规则
+type redactor struct {
+	rules []*redactRule
+}
+
+func newRedactor(c *Redaction) (*redactor, error) {
+	marker := c.Marker
+	if marker == "" {
+		marker = redactMarkerDefault
+	}
+
+	var rules []*redactRule
+	for _, f := range c.Fields {
+		rules = append(rules, fieldRule(f, []string{f}))
+	}
+	for _, d := range c.Detectors {
+		detector, ok := redactDetectors[d]
+		if !ok {
+			return nil, fmt.Errorf("unknown redaction detector %s", d)
+		}
+		rules = append(rules, detector()...)
+	}
+	for i, rule := range c.Rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule %d %s: %v", i, rule.Name, err)
+		}
+		name := rule.Name
+		if name == "" {
+			name = "rule"
+		}
+		rules = append(rules, &redactRule{name: name, re: re, replace: rule.Replace})
+	}
+
+	for _, r := range rules {
+		r.marker = strings.ReplaceAll(marker, "{name}", r.name)
+	}
+	return &redactor{rules: rules}, nil
+}
+
+func (r *redactor) redact(s string) string {
+	for _, rule := range r.rules {
+		s = rule.apply(s)
+	}
+	return s
+}
+
+// SetRedaction 设置日志内容的脱敏，nil 取消
+func (this *LocalHTLog) SetRedaction(c *Redaction) error {
+	var r *redactor
+	if c != nil {
+		var err error
+		r, err = newRedactor(c)
+		if err != nil {
+			return err
+		}
+	}
+	this.redactor.Store(r)
+	return nil
+}
+
+// SetRedaction sets the redaction of the defaultHTLog.
+func SetRedaction(c *Redaction) error {
+	return defaultHTLog.SetRedaction(c)
+}
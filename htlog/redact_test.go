@@ -0,0 +1,102 @@
+package htlog
+
+import (
+	"testing"
+)
+
+// 内置检测，字段和自定义规则，要隐藏的和不应改动的内容
+func TestRedactRules(t *testing.T) {
+	r, err := newRedactor(&Redaction{
+		Detectors: []string{"password", "token", "card", "email"},
+		Fields:    []string{"session"},
+		Rules:     []RedactRule{{Name: "phone", Pattern: `(1[3-9]\d)\d{4}(\d{4})`, Replace: "$1****$2"}},
+		Marker:    "<{name}>",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name, in, want string
+	}{
+		{"password", "login password=123456 ok", "login password=<password> ok"},
+		{"password colon", "Passwd: hunter2, next", "Passwd: <password>, next"},
+		{"password json", `{"pwd":"a b"}`, `{"pwd":"<password>"}`},
+		{"password word", "reset your password now", "reset your password now"},
+		{"bearer", "Authorization: Bearer abc.def-ghi", "Authorization: Bearer <token>"},
+		{"jwt", "jwt eyJhbGciOi.eyJzdWIiOi.sig_x", "jwt <token>"},
+		{"token field", "api_key=k123&x=1", "api_key=<token>&x=1"},
+		{"token word", "token expired", "token expired"},
+		{"card", "pay 4111 1111 1111 1111 done", "pay <card> done"},
+		{"card dashes", "pay 4111-1111-1111-1111", "pay <card>"},
+		{"card bad luhn", "order 4111 1111 1111 1112", "order 4111 1111 1111 1112"},
+		{"card short", "order 1234567890", "order 1234567890"},
+		{"email", "user bob.smith+x@example.co.uk", "user <email>"},
+		{"email no domain", "user bob@localhost", "user bob@localhost"},
+		{"field", "session=abcd user=bob", "session=<session> user=bob"},
+		{"field quoted", `SESSION: "a b c"`, `SESSION: "<session>"`},
+		{"field prefix", "sessions=3", "sessions=3"},
+		{"rule", "call 13812345678", "call 138****5678"},
+		{"rule other", "call 12812345678", "call 12812345678"},
+	}
+	for _, c := range cases {
+		if got := r.redact(c.in); got != c.want {
+			t.Errorf("%s: %q got %q, want %q", c.name, c.in, got, c.want)
+		}
+	}
+}
+
+func TestRedactLuhn(t *testing.T) {
+	cases := []struct {
+		in   string
+		want bool
+	}{
+		{"4111111111111111", true},
+		{"4111 1111 1111 1111", true},
+		{"5500-0000-0000-0004", true},
+		{"4111111111111112", false},
+		{"411111111111", false},         // 12位
+		{"41111111111111111111", false}, // 20位
+	}
+	for _, c := range cases {
+		if got := luhn(c.in); got != c.want {
+			t.Errorf("luhn(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRedactConfig(t *testing.T) {
+	r, err := newRedactor(&Redaction{Detectors: []string{"email"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.redact("a@b.io"); got != "[REDACTED:email]" {
+		t.Fatalf("default marker: %q", got)
+	}
+	if _, err := newRedactor(&Redaction{Detectors: []string{"nope"}}); err == nil {
+		t.Fatal("an unknown detector was accepted")
+	}
+	if _, err := newRedactor(&Redaction{Rules: []RedactRule{{Pattern: "("}}}); err == nil {
+		t.Fatal("a bad pattern was accepted")
+	}
+}
+
+// Panic 的内容也脱敏
+func TestPanicRedacted(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.Reset()
+	l.SetHTLog(AdapterMemory, `{"entries":10}`)
+	l.SetRedaction(&Redaction{Detectors: []string{"password"}})
+
+	defer func() {
+		r := recover()
+		if r != "login password=[REDACTED:password]" {
+			t.Fatalf("panic with %v", r)
+		}
+		got := QueryMemory(MemoryQuery{})
+		if len(got) != 1 || got[0].Content != "###Exec Panic:login password=[REDACTED:password]" {
+			t.Fatalf("got %v", got)
+		}
+	}()
+	l.Panic("login password=%s", "hunter2")
+}
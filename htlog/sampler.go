@@ -0,0 +1,272 @@
+package htlog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SamplePolicy 是一个调用位置的采样策略：每个周期先输出First条，之后每Thereafter条输出1条
+type SamplePolicy struct {
+	First      int    `json:"first"`
+	Thereafter int    `json:"thereafter"` // 0 丢弃周期内其余的日志
+	Period     string `json:"period"`     // 周期，比如 "1s"，默认1秒
+}
+
+// Sampling 是日志的采样和限流配置
+//
+//	{
+//	"levels": {"DEBG": {"first": 100, "thereafter": 100}},
+//	"sites": {"app/db/query.go:42": {"first": 10, "period": "1m"}},
+//	"rate": 1000,
+//	"burst": 2000,
+//	"exempt": "EROR",
+//	"summary": "10s"
+//	}
+type Sampling struct {
+	Levels  map[string]*SamplePolicy `json:"levels"`  // 按等级，每个调用位置单独计数
+	Sites   map[string]*SamplePolicy `json:"sites"`   // 按调用位置 path:line 的后缀，优先于等级
+	Rate    float64                  `json:"rate"`    // 全局每秒最多条数，0不限制
+	Burst   int                      `json:"burst"`   // 全局令牌桶大小，默认等于rate
+	Exempt  string                   `json:"exempt"`  // 这个等级及更高优先级的日志不受全局限流，默认EROR，NONE都受限流
+	Summary string                   `json:"summary"` // 输出丢弃条数的间隔，默认10s
+}
+
+const (
+	samplePeriodDefault  = time.Second
+	sampleSummaryDefault = 10 * time.Second
+	sampleSummaryTop     = 5 // 汇总中列出的调用位置个数
+)
+
+type samplePolicy struct {
+	first, thereafter int
+	period            time.Duration
+}
+
+type siteCount struct {
+	start time.Time
+	n     int
+}
+
+// sampler 按调用位置采样，再用全局令牌桶限流，被丢弃的条数定期汇总输出
+type sampler struct {
+	levels  [LevelTrace + 1]*samplePolicy
+	sites   map[string]*samplePolicy
+	rate    float64
+	burst   float64
+	exempt  int // 不受全局限流的最低优先级，-1都受限流
+	summary time.Duration
+	report  func(n int, sites map[string]int)
+
+	mu         sync.Mutex
+	counts     map[string]*siteCount
+	tokens     float64
+	last       time.Time
+	suppressed map[string]int
+	timer      *time.Timer
+}
+
+func newSampler(s *Sampling, report func(n int, sites map[string]int)) (*sampler, error) {
+	sp := &sampler{
+		sites:      map[string]*samplePolicy{},
+		rate:       s.Rate,
+		burst:      float64(s.Burst),
+		exempt:     LevelError,
+		summary:    sampleSummaryDefault,
+		report:     report,
+		counts:     map[string]*siteCount{},
+		suppressed: map[string]int{},
+	}
+	for name, p := range s.Levels {
+		l, ok := LevelMap[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown level %s", name)
+		}
+		policy, err := newSamplePolicy(p)
+		if err != nil {
+			return nil, err
+		}
+		sp.levels[l] = policy
+	}
+	for site, p := range s.Sites {
+		policy, err := newSamplePolicy(p)
+		if err != nil {
+			return nil, err
+		}
+		sp.sites[site] = policy
+	}
+	switch s.Exempt {
+	case "":
+	case "NONE":
+		sp.exempt = -1
+	default:
+		l, ok := LevelMap[s.Exempt]
+		if !ok {
+			return nil, fmt.Errorf("unknown level %s", s.Exempt)
+		}
+		sp.exempt = l
+	}
+	if sp.burst <= 0 {
+		sp.burst = sp.rate
+	}
+	sp.tokens = sp.burst
+	if s.Summary != "" {
+		d, err := time.ParseDuration(s.Summary)
+		if err != nil {
+			return nil, err
+		}
+		sp.summary = d
+	}
+	return sp, nil
+}
+
+func newSamplePolicy(p *SamplePolicy) (*samplePolicy, error) {
+	policy := &samplePolicy{first: p.First, thereafter: p.Thereafter, period: samplePeriodDefault}
+	if p.Period != "" {
+		d, err := time.ParseDuration(p.Period)
+		if err != nil {
+			return nil, err
+		}
+		policy.period = d
+	}
+	return policy, nil
+}
+
+// 调用位置src的日志是否输出
+func (sp *sampler) allow(src string, level int, now time.Time) bool {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if sp.sample(src, level, now) && (level <= sp.exempt || sp.take(now)) {
+		return true
+	}
+	sp.suppressed[src]++
+	if sp.timer == nil {
+		sp.timer = time.AfterFunc(sp.summary, sp.flush)
+	}
+	return false
+}
+
+// 采样，需要sp.mu
+func (sp *sampler) sample(src string, level int, now time.Time) bool {
+	policy := sp.levels[level]
+	match := -1
+	for site, p := range sp.sites {
+		if len(site) > match && strings.HasSuffix(src, site) {
+			match, policy = len(site), p
+		}
+	}
+	if policy == nil {
+		return true
+	}
+
+	c, ok := sp.counts[src]
+	if !ok || now.Sub(c.start) >= policy.period {
+		c = &siteCount{start: now}
+		sp.counts[src] = c
+	}
+	c.n++
+	if c.n <= policy.first {
+		return true
+	}
+	return policy.thereafter > 0 && (c.n-policy.first)%policy.thereafter == 0
+}
+
+// 从令牌桶取一个令牌，需要sp.mu
+func (sp *sampler) take(now time.Time) bool {
+	if sp.rate <= 0 {
+		return true
+	}
+	if !sp.last.IsZero() {
+		sp.tokens = min(sp.burst, sp.tokens+now.Sub(sp.last).Seconds()*sp.rate)
+	}
+	sp.last = now
+	if sp.tokens < 1 {
+		return false
+	}
+	sp.tokens--
+	return true
+}
+
+// 输出丢弃的条数
+func (sp *sampler) flush() {
+	sp.mu.Lock()
+	suppressed := sp.suppressed
+	sp.suppressed = map[string]int{}
+	sp.timer = nil
+	sp.mu.Unlock()
+
+	n := 0
+	for _, c := range suppressed {
+		n += c
+	}
+	if n > 0 {
+		sp.report(n, suppressed)
+	}
+}
+
+// 停止汇总定时器并输出还没汇总的条数
+func (sp *sampler) stop() {
+	sp.mu.Lock()
+	timer := sp.timer
+	sp.mu.Unlock()
+	if timer != nil && timer.Stop() {
+		sp.flush()
+	}
+}
+
+// 汇总行，比如 suppressed 1200 messages (app/db/query.go:42: 1100, app/api.go:10: 100)
+func summaryLine(n int, sites map[string]int) string {
+	names := make([]string, 0, len(sites))
+	for site := range sites {
+		names = append(names, site)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if sites[names[i]] != sites[names[j]] {
+			return sites[names[i]] > sites[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	if len(names) > sampleSummaryTop {
+		names = names[:sampleSummaryTop]
+	}
+	parts := make([]string, 0, len(names))
+	for _, site := range names {
+		parts = append(parts, fmt.Sprintf("%s: %d", site, sites[site]))
+	}
+	return fmt.Sprintf("suppressed %d messages (%s)", n, strings.Join(parts, ", "))
+}
+
+// SetSampling 设置日志的采样和限流，nil 取消
+func (this *LocalHTLog) SetSampling(s *Sampling) error {
+	var sp *sampler
+	if s != nil {
+		var err error
+		sp, err = newSampler(s, this.writeSummary)
+		if err != nil {
+			return err
+		}
+	}
+	if old := this.sampler.Swap(sp); old != nil {
+		old.stop()
+	}
+	return nil
+}
+
+// 输出被采样和限流丢弃的条数，不经过采样
+func (this *LocalHTLog) writeSummary(n int, sites map[string]int) {
+	when := time.Now()
+	this.writeToHTLogs(when, &loginfo{
+		Time:    when.Format(this.timeFormat),
+		Level:   levelPrefix[LevelWarning],
+		Path:    "htlog",
+		Name:    this.appName,
+		Content: summaryLine(n, sites),
+	}, LevelWarning)
+}
+
+// SetSampling sets the sampling of the defaultHTLog.
+func SetSampling(s *Sampling) error {
+	return defaultHTLog.SetSampling(s)
+}
@@ -0,0 +1,62 @@
+package htlog
+
+import (
+	"testing"
+)
+
+// 没有输出接受的日志不计入采样和限流，EROR及更高优先级不受全局限流
+func TestSamplingOutputLevels(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.Reset()
+	if err := l.SetHTLog(AdapterMemory, `{"level":"INFO"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetSampling(&Sampling{Rate: 1, Burst: 1, Summary: "1h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 1000; i++ {
+		l.Debug("debug %d", i)
+	}
+	l.Info("info")
+	l.Warn("warn")
+	l.Error("error")
+
+	got := QueryMemory(MemoryQuery{})
+	if len(got) != 2 || got[0].Content != "info" || got[1].Content != "error" {
+		t.Fatalf("got %v, want info and error", got)
+	}
+	sp := l.sampler.Load()
+	sp.mu.Lock()
+	suppressed := 0
+	for _, n := range sp.suppressed {
+		suppressed += n
+	}
+	sp.mu.Unlock()
+	if suppressed != 1 {
+		t.Fatalf("%d suppressed, want the warn only", suppressed)
+	}
+}
+
+// exempt为NONE时所有等级都受全局限流
+func TestSamplingExemptNone(t *testing.T) {
+	l := NewHTLog()
+	defer l.Close()
+	l.Reset()
+	if err := l.SetHTLog(AdapterMemory, `{"level":"INFO"}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.SetSampling(&Sampling{Rate: 1, Burst: 1, Exempt: "NONE", Summary: "1h"}); err != nil {
+		t.Fatal(err)
+	}
+
+	l.Info("info")
+	l.Emer("emer")
+	if got := QueryMemory(MemoryQuery{}); len(got) != 1 || got[0].Content != "info" {
+		t.Fatalf("got %v, want info only", got)
+	}
+	if err := l.SetSampling(&Sampling{Exempt: "HIGH"}); err == nil {
+		t.Fatal("an unknown exempt level was accepted")
+	}
+}